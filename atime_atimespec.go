@@ -0,0 +1,19 @@
+//go:build darwin || freebsd || netbsd
+
+package cp
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// fileAtime returns the access time of the file info.
+// It falls back to the modification time if the access time is unavailable.
+func fileAtime(fi fs.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(int64(st.Atimespec.Sec), int64(st.Atimespec.Nsec))
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package cp
+
+import (
+	"io/fs"
+	"time"
+)
+
+// fileAtime returns the access time of the file info.
+// The access time is not available on this platform and it returns the modification time.
+func fileAtime(fi fs.FileInfo) time.Time {
+	return fi.ModTime()
+}
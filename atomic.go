@@ -0,0 +1,97 @@
+package cp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// openTemp opens an unnamed temporary file in dir.
+// It's a variable to test the fallback to the named temporary file.
+var openTemp = openUnnamedTemp
+
+// createTemp creates a temporary file in the dir of dst to write the content atomically.
+// It tries an unnamed temporary file(O_TMPFILE) first on Linux.
+// Call linkTemp to get the name of the temporary file after writing.
+func createTemp(dst string) (*os.File, error) {
+	dir := filepath.Dir(dst)
+
+	f, err := openTemp(dir)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return nil, err
+	}
+
+	if f, err = os.CreateTemp(dir, "."+filepath.Base(dst)+".*.tmp"); err != nil {
+		return nil, err
+	}
+
+	// os.CreateTemp creates the file with 0600.
+	// Make it the same as the file created without the atomic mode.
+	if err = f.Chmod(0644); err != nil {
+		removeTemp(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+// linkTemp returns the name of the temporary file created by createTemp.
+// The unnamed temporary file is linked to a temporary name in the dir of dst.
+func linkTemp(f *os.File, dst string) (string, error) {
+	if !isUnnamedTemp(f) {
+		return f.Name(), nil
+	}
+	return linkUnnamedTemp(f, dst)
+}
+
+// removeTemp closes and removes the temporary file created by createTemp.
+// The unnamed temporary file is removed automatically by the kernel.
+func removeTemp(f *os.File) {
+	f.Close()
+	if !isUnnamedTemp(f) {
+		os.Remove(f.Name())
+	}
+}
+
+// writeFileAtomic writes data to a temporary file in the dir of name and renames it to name.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		removeTemp(f)
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err = os.Rename(f.Name(), name); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// syncDir flushes the dir entries of dir to make the rename durable.
+// It does nothing on Windows which does not support to sync dirs.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
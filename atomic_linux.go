@@ -0,0 +1,52 @@
+package cp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// openUnnamedTemp opens an unnamed temporary file in dir by O_TMPFILE.
+// It returns errors.ErrUnsupported if O_TMPFILE or /proc is not available.
+func openUnnamedTemp(dir string) (*os.File, error) {
+	// /proc/self/fd is required to link the file.
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		return nil, errors.ErrUnsupported
+	}
+
+	f, err := os.OpenFile(dir, os.O_WRONLY|unix.O_TMPFILE, 0644)
+	if err != nil {
+		return nil, errors.ErrUnsupported
+	}
+	return f, nil
+}
+
+// isUnnamedTemp reports whether f is opened by openUnnamedTemp.
+// The name of an unnamed temporary file is the name of its dir.
+func isUnnamedTemp(f *os.File) bool {
+	fi, err := os.Stat(f.Name())
+	return err == nil && fi.IsDir()
+}
+
+// linkUnnamedTemp links the unnamed temporary file to a random name in the dir of dst.
+func linkUnnamedTemp(f *os.File, dst string) (string, error) {
+	proc := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s.%d.tmp", filepath.Base(dst), rand.Uint32()))
+
+		err := unix.Linkat(unix.AT_FDCWD, proc, unix.AT_FDCWD, name, unix.AT_SYMLINK_FOLLOW)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, unix.EEXIST) {
+			return "", &fs.PathError{Op: "linkat", Path: name, Err: err}
+		}
+	}
+	return "", &fs.PathError{Op: "linkat", Path: dst, Err: fs.ErrExist}
+}
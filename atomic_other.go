@@ -0,0 +1,24 @@
+//go:build !linux
+
+package cp
+
+import (
+	"errors"
+	"os"
+)
+
+// openUnnamedTemp opens an unnamed temporary file in dir.
+// It's not supported on this platform and always returns errors.ErrUnsupported.
+func openUnnamedTemp(dir string) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// isUnnamedTemp reports whether f is opened by openUnnamedTemp.
+func isUnnamedTemp(f *os.File) bool {
+	return false
+}
+
+// linkUnnamedTemp links the unnamed temporary file to a name in the dir of dst.
+func linkUnnamedTemp(f *os.File, dst string) (string, error) {
+	return "", errors.ErrUnsupported
+}
@@ -0,0 +1,169 @@
+//go:build unix
+
+package cp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useNamedTemp makes createTemp fall back to the named temporary files in the test.
+func useNamedTemp(t *testing.T) {
+	t.Helper()
+
+	openTemp = func(dir string) (*os.File, error) {
+		return nil, errors.ErrUnsupported
+	}
+	t.Cleanup(func() { openTemp = openUnnamedTemp })
+}
+
+// checkNoTemp checks that there're no temporary files left in dir.
+func checkNoTemp(t *testing.T, dir string) {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("temporary files are left: %v", matches)
+	}
+}
+
+// newAtomicSrc creates a file of 4 MiB with mode 0600 and an old modification time.
+func newAtomicSrc(t *testing.T) (string, []byte, time.Time) {
+	t.Helper()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(src, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return src, content, mtime
+}
+
+func TestCopyFileAtomic(t *testing.T) {
+	for _, name := range []string{"unnamed", "named"} {
+		t.Run(name, func(t *testing.T) {
+			if name == "named" {
+				useNamedTemp(t)
+			} else {
+				f, err := createTemp(filepath.Join(t.TempDir(), "dst"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				unnamed := isUnnamedTemp(f)
+				removeTemp(f)
+				if !unnamed {
+					t.Skip("O_TMPFILE is not available")
+				}
+			}
+
+			src, content, mtime := newAtomicSrc(t)
+			dir := t.TempDir()
+			dst := filepath.Join(dir, "dst")
+
+			// Watch dst while copying. It should never be seen with the final name before the attributes are applied.
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			var seen error
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+
+					fi, err := os.Stat(dst)
+					if err != nil {
+						continue
+					}
+					if fi.Mode().Perm() != 0600 || !fi.ModTime().Equal(mtime) || fi.Size() != int64(len(content)) {
+						seen = errors.New("dst is seen before the content and attributes are ready: " + fi.Mode().String())
+						return
+					}
+				}
+			}()
+
+			opts := &Options{Atomic: true, Preserve: PreserveMode | PreserveTimes, FastPath: FastPathNever}
+			n, err := CopyFileWithOptions(context.Background(), src, dst, 0, opts)
+			close(stop)
+			wg.Wait()
+
+			if err != nil {
+				t.Fatalf("CopyFileWithOptions() error: %v", err)
+			}
+			if seen != nil {
+				t.Error(seen)
+			}
+			if n != int64(len(content)) {
+				t.Errorf("CopyFileWithOptions() = %v, want %v", n, len(content))
+			}
+
+			data, err := os.ReadFile(dst)
+			if err != nil || !bytes.Equal(data, content) {
+				t.Errorf("content of dst differs: %v", err)
+			}
+
+			fi, err := os.Stat(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != 0600 || !fi.ModTime().Equal(mtime) {
+				t.Errorf("dst mode = %v, mtime = %v, want %v, %v", fi.Mode().Perm(), fi.ModTime(), os.FileMode(0600), mtime)
+			}
+			checkNoTemp(t, dir)
+		})
+	}
+}
+
+func TestCopyFileAtomicCancel(t *testing.T) {
+	for _, name := range []string{"unnamed", "named"} {
+		t.Run(name, func(t *testing.T) {
+			if name == "named" {
+				useNamedTemp(t)
+			}
+
+			src, _, _ := newAtomicSrc(t)
+			dir := t.TempDir()
+			dst := filepath.Join(dir, "dst")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Stop the copy after the first write.
+			opts := &Options{
+				Atomic:   true,
+				FastPath: FastPathNever,
+				Buf:      make([]byte, 64*1024),
+				OnWritten: func(total, prev, current int64, percent float32) {
+					cancel()
+				},
+			}
+
+			_, err := CopyFileWithOptions(ctx, src, dst, 0, opts)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("CopyFileWithOptions() error = %v, want context.Canceled", err)
+			}
+
+			if _, err = os.Lstat(dst); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Lstat(dst) error = %v, want ErrNotExist", err)
+			}
+			checkNoTemp(t, dir)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package cp
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Default interval to save the checkpoint of dir copies.
+	DefaultCheckpointInterval = 5 * time.Second
+)
+
+var (
+	// ErrCheckpointMismatch represents the error that the checkpoint is not for the src and dst to resume.
+	ErrCheckpointMismatch = errors.New("checkpoint mismatch")
+)
+
+// Checkpoint contains the state of a dir copy or a file copied in chunks to resume.
+// It's saved as JSON to the file specified by Options.Checkpoint.
+// For a file copied in chunks, Src and Dst are the files and Size and ModTime are the ones of Src.
+type Checkpoint struct {
+	// Source dir.
+	Src string `json:"src"`
+	// Destination dir.
+	Dst string `json:"dst"`
+	// Slash-separated relative paths of the completed files.
+	Done []string `json:"done"`
+	// Slash-separated relative path of the partially copied file.
+	Current string `json:"current,omitempty"`
+	// Number of bytes of the current file copied.
+	Offset int64 `json:"offset,omitempty"`
+	// Size of the current file when the copy started.
+	Size int64 `json:"size,omitempty"`
+	// Modification time of the current file when the copy started.
+	ModTime time.Time `json:"mod_time,omitzero"`
+	// Size of the chunks of the file copied in chunks.
+	ChunkSize int64 `json:"chunk_size,omitempty"`
+	// Completion of the chunks of the file copied in chunks.
+	Chunks []bool `json:"chunks,omitempty"`
+}
+
+// LoadCheckpoint loads the checkpoint from the file.
+func LoadCheckpoint(name string) (*Checkpoint, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ckpt := &Checkpoint{}
+	if err := json.Unmarshal(data, ckpt); err != nil {
+		return nil, err
+	}
+	return ckpt, nil
+}
+
+// save saves the checkpoint to the file atomically.
+func (ckpt *Checkpoint) save(name string) error {
+	data, err := json.Marshal(ckpt)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, data)
+}
+
+// clearCurrent clears the state of the current file.
+func (ckpt *Checkpoint) clearCurrent() {
+	ckpt.Current, ckpt.Offset = "", 0
+	ckpt.Size, ckpt.ModTime = 0, time.Time{}
+}
+
+// match reports whether the checkpoint is for the src and dst.
+func (ckpt *Checkpoint) match(src, dst string) bool {
+	return filepath.Clean(ckpt.Src) == filepath.Clean(src) && filepath.Clean(ckpt.Dst) == filepath.Clean(dst)
+}
+
+// loadCheckpointFor loads the checkpoint from the file and checks if it's for the src and dst.
+func loadCheckpointFor(name, src, dst string) (*Checkpoint, error) {
+	ckpt, err := LoadCheckpoint(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ckpt.match(src, dst) {
+		return nil, ErrCheckpointMismatch
+	}
+	return ckpt, nil
+}
@@ -0,0 +1,255 @@
+package cp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/northbright/iocopy"
+)
+
+const (
+	// Default size of the chunks of a file copied in parallel.
+	DefaultChunkSize = 16 * 1024 * 1024
+)
+
+// chunkState contains the state of a file copied in chunks.
+type chunkState struct {
+	// Size of the chunks.
+	size int64
+	// Completion of the chunks.
+	done []bool
+	// Whether the copy is resumed from a checkpoint. dst is kept to resume the copy.
+	resume bool
+	// Checkpoint to save the completion of the chunks. It's nil if Options.Checkpoint is not set.
+	ckpt *Checkpoint
+	// Checkpoint file.
+	name string
+	// Interval to save the checkpoint.
+	interval time.Duration
+	// Time of the last checkpoint saved.
+	saved time.Time
+}
+
+// newChunkState returns the state to copy the file in chunks.
+// It returns nil if the file should be copied sequentially.
+// fi: file info of src.
+// ckpt: checkpoint to resume the copy. Leave it nil to start a new copy.
+func newChunkState(src, dst string, fi fs.FileInfo, opts *Options, ckpt *Checkpoint) (*chunkState, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	size := fi.Size()
+	if opts.ChunkWorkers <= 1 || size <= chunkSize {
+		return nil, nil
+	}
+
+	ck := &chunkState{
+		size: chunkSize,
+		done: make([]bool, (size+chunkSize-1)/chunkSize),
+	}
+
+	if ckpt != nil && len(ckpt.Chunks) > 0 {
+		// Check if the source file is changed since the checkpoint.
+		changed := ckpt.Size != size || !ckpt.ModTime.Equal(fi.ModTime())
+		if changed && opts.ResumeCheck != ResumeCheckNone {
+			return nil, resumeMismatchError(src)
+		}
+
+		// Resume the chunks if the checkpoint is for the same file and chunk size.
+		if !changed && ckpt.ChunkSize == chunkSize && len(ckpt.Chunks) == len(ck.done) {
+			copy(ck.done, ckpt.Chunks)
+			ck.resume = true
+		}
+	}
+
+	// dst is preallocated to the size of src before copying the chunks.
+	if ck.resume {
+		if dfi, err := os.Stat(dst); err != nil || dfi.Size() != size {
+			if opts.ResumeCheck != ResumeCheckNone {
+				return nil, resumeMismatchError(dst)
+			}
+			ck.reset()
+		}
+	}
+
+	// The temporary file of the atomic mode is removed on failure, so there's nothing to resume.
+	if opts.Checkpoint != "" && !opts.Atomic {
+		ck.ckpt = &Checkpoint{Src: src, Dst: dst, Size: size, ModTime: fi.ModTime(), ChunkSize: chunkSize, Chunks: ck.done}
+		ck.name = opts.Checkpoint
+		ck.interval = opts.CheckpointInterval
+		if ck.interval <= 0 {
+			ck.interval = DefaultCheckpointInterval
+		}
+		ck.saved = time.Now()
+	}
+	return ck, nil
+}
+
+// reset marks all chunks not completed to restart the copy.
+func (ck *chunkState) reset() {
+	clear(ck.done)
+	ck.resume = false
+}
+
+// doneBytes returns the number of bytes of the completed chunks.
+func (ck *chunkState) doneBytes(size int64) int64 {
+	var n int64
+	for i, done := range ck.done {
+		if done {
+			n += min(ck.size, size-int64(i)*ck.size)
+		}
+	}
+	return n
+}
+
+// save saves the checkpoint if it's set.
+func (ck *chunkState) save() error {
+	if ck.ckpt == nil {
+		return nil
+	}
+
+	ck.saved = time.Now()
+	return ck.ckpt.save(ck.name)
+}
+
+// saveIfDue saves the checkpoint if the interval elapsed.
+func (ck *chunkState) saveIfDue() error {
+	if ck.ckpt == nil || time.Since(ck.saved) < ck.interval {
+		return nil
+	}
+	return ck.save()
+}
+
+// remove removes the checkpoint file after the copy is done.
+func (ck *chunkState) remove() error {
+	if ck.ckpt == nil {
+		return nil
+	}
+
+	if err := os.Remove(ck.name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// copyChunks copies the chunks of src which are not completed to dst concurrently.
+// dst should be preallocated to size.
+// It returns the number of bytes written and the first error of the workers.
+// size: size of src.
+// total, prev: total size and number of bytes copied previously to report progress.
+func copyChunks(
+	ctx context.Context,
+	dst *os.File,
+	src io.ReaderAt,
+	size int64,
+	total int64,
+	prev int64,
+	opts *Options,
+	ck *chunkState) (n int64, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Count the bytes of the completed chunks as done.
+	prev += ck.doneBytes(size)
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	// fail records the first error and stops the other workers.
+	fail := func(e error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err == nil {
+			err = e
+			cancel()
+		}
+	}
+
+	indexes := make(chan int)
+
+	for range opts.ChunkWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// The buffer can not be shared by the workers.
+			var buf []byte
+			if len(opts.Buf) > 0 {
+				buf = make([]byte, len(opts.Buf))
+			}
+
+			for i := range indexes {
+				off := int64(i) * ck.size
+				length := min(ck.size, size-off)
+
+				// Bytes written of the chunk reported last time.
+				var last int64
+
+				fn := func(_, _, current int64, _ float32) {
+					mu.Lock()
+					defer mu.Unlock()
+
+					n += current - last
+					last = current
+					reportProgress(opts.OnWritten, total, prev, n)
+				}
+
+				written, e := iocopy.CopyBufferWithProgress(ctx, io.NewOffsetWriter(dst, off), io.NewSectionReader(src, off, length), buf, length, 0, fn)
+
+				mu.Lock()
+				n += written - last
+				mu.Unlock()
+
+				if e == nil && written < length {
+					e = io.ErrUnexpectedEOF
+				}
+				if e != nil {
+					fail(e)
+					continue
+				}
+
+				mu.Lock()
+				ck.done[i] = true
+				e = ck.saveIfDue()
+				mu.Unlock()
+
+				if e != nil {
+					fail(e)
+				}
+			}
+		}()
+	}
+
+	// Send the chunks not completed to the workers.
+loop:
+	for i, done := range ck.done {
+		if done {
+			continue
+		}
+
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	// Stopped by the parent context before all chunks are sent.
+	if err == nil && ctx.Err() != nil && slices.Contains(ck.done, false) {
+		err = ctx.Err()
+	}
+	return n, err
+}
@@ -0,0 +1,178 @@
+package cp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/northbright/cp"
+)
+
+const testChunkSize = 64 * 1024
+
+// newChunkSrc creates a file of 5 full chunks and a partial one.
+func newChunkSrc(t *testing.T) (string, []byte) {
+	t.Helper()
+
+	content := make([]byte, 5*testChunkSize+1234)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return src, content
+}
+
+func TestCopyFileChunks(t *testing.T) {
+	src, content := newChunkSrc(t)
+	dst := filepath.Join(t.TempDir(), "dst")
+	r := &progressRecorder{t: t, total: int64(len(content))}
+
+	opts := &cp.Options{
+		ChunkWorkers: 3,
+		ChunkSize:    testChunkSize,
+		Buf:          make([]byte, 4096),
+		OnWritten:    r.onWritten,
+	}
+
+	n, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, opts)
+	if err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	if n != int64(len(content)) || r.last != n {
+		t.Errorf("CopyFileWithOptions() = %v, last progress %v, want %v", n, r.last, len(content))
+	}
+	if data, err := os.ReadFile(dst); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("content of dst differs: %v", err)
+	}
+}
+
+func TestResumeCopyFileSkipsCompletedChunks(t *testing.T) {
+	src, content := newChunkSrc(t)
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst")
+	size := int64(len(content))
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The completed chunks of dst are filled with the bytes differing from src.
+	// They're kept if the chunks are skipped.
+	chunks := []bool{true, false, true, false, false, true}
+	data := bytes.Repeat([]byte("x"), len(content))
+	if err = os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ckpt := cp.Checkpoint{Src: src, Dst: dst, Size: size, ModTime: fi.ModTime(), ChunkSize: testChunkSize, Chunks: chunks}
+	b, err := json.Marshal(ckpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "checkpoint.json")
+	if err = os.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bytes of the chunks to copy.
+	var want int64
+	for i, done := range chunks {
+		off := int64(i) * testChunkSize
+		end := min(off+testChunkSize, size)
+		if !done {
+			copy(data[off:end], content[off:end])
+			want += end - off
+		}
+	}
+
+	r := &progressRecorder{t: t, total: size}
+	opts := &cp.Options{
+		ChunkWorkers: 2,
+		ChunkSize:    testChunkSize,
+		Checkpoint:   name,
+		ResumeCheck:  cp.ResumeCheckSize,
+		OnWritten:    r.onWritten,
+	}
+
+	n, err := cp.ResumeCopyFile(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatalf("ResumeCopyFile() error: %v", err)
+	}
+	if n != want || r.last != size {
+		t.Errorf("ResumeCopyFile() = %v, last progress %v, want %v, %v", n, r.last, want, size)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("completed chunks are copied again or the others are not copied: %v", err)
+	}
+
+	if _, err = os.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(checkpoint) error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestResumeCopyFileChunksAfterCancel(t *testing.T) {
+	src, content := newChunkSrc(t)
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst")
+	name := filepath.Join(dir, "checkpoint.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop the copy after the first bytes are written.
+	opts := &cp.Options{
+		ChunkWorkers: 2,
+		ChunkSize:    testChunkSize,
+		Buf:          make([]byte, 4096),
+		Checkpoint:   name,
+		OnWritten: func(total, prev, current int64, percent float32) {
+			cancel()
+		},
+	}
+
+	n, err := cp.ResumeCopyFile(ctx, src, dst, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ResumeCopyFile() error = %v, want context.Canceled", err)
+	}
+
+	ckpt, err := cp.LoadCheckpoint(name)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint() error: %v", err)
+	}
+
+	// Bytes of the chunks completed before the copy stopped.
+	var done int64
+	for i, ok := range ckpt.Chunks {
+		if ok {
+			done += min(testChunkSize, int64(len(content))-int64(i)*testChunkSize)
+		}
+	}
+	if done > n {
+		t.Errorf("%v bytes of the chunks completed, but %v bytes written", done, n)
+	}
+
+	r := &progressRecorder{t: t, total: int64(len(content))}
+	opts.OnWritten = r.onWritten
+
+	n, err = cp.ResumeCopyFile(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatalf("ResumeCopyFile() error: %v", err)
+	}
+	if want := int64(len(content)) - done; n != want || r.last != int64(len(content)) {
+		t.Errorf("ResumeCopyFile() = %v, last progress %v, want %v, %v", n, r.last, want, len(content))
+	}
+	if data, err := os.ReadFile(dst); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("content of dst differs: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package cp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+)
+
+// CompareMode specifies how to detect the unchanged files to skip in dir copies.
+type CompareMode int
+
+const (
+	// CompareNone copies all files.
+	CompareNone CompareMode = iota
+	// CompareSizeModTime skips the file if dst has the same size and modification time.
+	// Set PreserveTimes to make the modification times comparable in the following copies.
+	CompareSizeModTime
+	// CompareChecksum skips the file if dst has the same size and SHA-256 checksum.
+	// Both files are read to compute the checksums.
+	CompareChecksum
+)
+
+// String implements [fmt.Stringer] interface.
+func (m CompareMode) String() string {
+	switch m {
+	case CompareNone:
+		return "none"
+	case CompareSizeModTime:
+		return "size+mtime"
+	case CompareChecksum:
+		return "checksum"
+	default:
+		return "CompareMode(" + strconv.Itoa(int(m)) + ")"
+	}
+}
+
+// unchanged reports whether dst is a regular file which is the same as the src file of the source by the compare mode.
+// fi: file info of src.
+func unchanged(ctx context.Context, s source, src, dst string, fi fs.FileInfo, opts *Options) (bool, error) {
+	if opts.Compare == CompareNone {
+		return false, nil
+	}
+
+	dfi, err := os.Stat(dst)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !dfi.Mode().IsRegular() || dfi.Size() != fi.Size() {
+		return false, nil
+	}
+
+	switch opts.Compare {
+	case CompareSizeModTime:
+		return dfi.ModTime().Equal(fi.ModTime()), nil
+	case CompareChecksum:
+		sum, err := fileSHA256(ctx, s, src, opts.Buf)
+		if err != nil {
+			return false, err
+		}
+
+		dsum, err := fileSHA256(ctx, osSource{}, dst, opts.Buf)
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(sum, dsum), nil
+	default:
+		return false, nil
+	}
+}
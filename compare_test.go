@@ -0,0 +1,91 @@
+package cp_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/northbright/cp"
+)
+
+// newCompareDirs copies src to dst with the modification times, then changes src:
+// the content of b.txt is changed with the same size, and c.txt is touched without changing the content.
+func newCompareDirs(t *testing.T) (src, dst string) {
+	t.Helper()
+
+	src, dst = filepath.Join(t.TempDir(), "src"), filepath.Join(t.TempDir(), "dst")
+	writeFiles(t, src, map[string]string{"a.txt": "hello", "b.txt": "world!", "sub/c.txt": "goodbye"})
+
+	if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, &cp.Options{Preserve: cp.PreserveTimes}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "b.txt"), []byte("WORLD!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	for _, name := range []string{"b.txt", "sub/c.txt"} {
+		if err := os.Chtimes(filepath.Join(src, filepath.FromSlash(name)), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src, dst
+}
+
+func TestCopyDirCompare(t *testing.T) {
+	for _, tc := range []struct {
+		mode cp.CompareMode
+		// Files to transfer.
+		copied map[string]bool
+		total  int64
+	}{
+		{cp.CompareSizeModTime, map[string]bool{"b.txt": true, "c.txt": true}, 13},
+		{cp.CompareChecksum, map[string]bool{"b.txt": true}, 6},
+	} {
+		src, dst := newCompareDirs(t)
+
+		di, err := cp.DirInfoWithDst(src, dst, &cp.Options{Compare: tc.mode})
+		if err != nil {
+			t.Fatalf("%v: DirInfoWithDst() error: %v", tc.mode, err)
+		}
+		if di.FileCount != int64(len(tc.copied)) || di.TotalSize != tc.total {
+			t.Errorf("%v: DirInfoWithDst() = FileCount %v, TotalSize %v, want %v, %v", tc.mode, di.FileCount, di.TotalSize, len(tc.copied), tc.total)
+		}
+
+		// The unchanged files are counted without dst.
+		if di, err = cp.DirInfoWithOptions(src, &cp.Options{Compare: tc.mode}); err != nil || di.FileCount != 3 {
+			t.Errorf("%v: DirInfoWithOptions() = FileCount %v, %v, want 3", tc.mode, di.FileCount, err)
+		}
+
+		r := &progressRecorder{t: t, total: tc.total}
+		outcomes := map[string]cp.Outcome{}
+		opts := &cp.Options{
+			Compare:   tc.mode,
+			OnWritten: r.onWritten,
+			AfterFile: func(r *cp.FileResult) {
+				outcomes[filepath.Base(r.Src)] = r.Outcome
+			},
+		}
+
+		n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+		if err != nil {
+			t.Fatalf("%v: CopyDirWithOptions() error: %v", tc.mode, err)
+		}
+		if n != tc.total || r.last != tc.total {
+			t.Errorf("%v: CopyDirWithOptions() = %v, last progress %v, want %v", tc.mode, n, r.last, tc.total)
+		}
+
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			want := cp.OutcomeSkipped
+			if tc.copied[name] {
+				want = cp.OutcomeOverwritten
+			}
+			if outcomes[name] != want {
+				t.Errorf("%v: outcome of %v = %v, want %v", tc.mode, name, outcomes[name], want)
+			}
+		}
+		checkFiles(t, dst, map[string]string{"a.txt": "hello", "b.txt": "WORLD!", "sub/c.txt": "goodbye"}, nil)
+	}
+}
@@ -2,10 +2,15 @@ package cp
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/northbright/iocopy"
 	"github.com/northbright/pathelper"
@@ -13,59 +18,84 @@ import (
 
 // DirInfoData contains dir information.
 type DirInfoData struct {
-	// Desired file extensions.
+	// Desired file extensions of Options.Exts or Filter.Exts.
 	Exts        []string
 	FileCount   int64
 	SubDirCount int64
-	TotalSize   int64
+	// Number of symlinks to preserve.
+	SymlinkCount int64
+	// Number of special files to recreate.
+	SpecialFileCount int64
+	// Number of hard links to recreate.
+	// They're not counted in FileCount and TotalSize.
+	HardLinkCount int64
+	TotalSize     int64
+
+	// Slash-separated relative paths of the unchanged files to skip by Options.Compare.
+	// They're not counted in FileCount and TotalSize.
+	unchanged map[string]bool
 }
 
 // DirInfo returns the dir info.
 // dir: directory to get info.
 // exts: desired file extensions. Leave it nil or empty for all files.
 func DirInfo(dir string, exts []string) (*DirInfoData, error) {
-	di := &DirInfoData{}
+	return dirInfo(context.Background(), osSource{}, dir, "", &Options{Exts: exts})
+}
 
-	for _, ext := range exts {
-		di.Exts = append(di.Exts, strings.ToLower(ext))
-	}
+// DirInfoWithOptions returns the dir info with the same options passed to [CopyDirWithOptions].
+// Options.Compare is not applied without dst, so the unchanged files are counted.
+// Use [DirInfoWithDst] to get the totals of a copy to dst.
+// dir: directory to get info.
+// opts: options of the copy. Leave it nil to use the default options.
+func DirInfoWithOptions(dir string, opts *Options) (*DirInfoData, error) {
+	return dirInfo(context.Background(), osSource{}, dir, "", opts)
+}
 
-	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
-		// Check err first.
-		// d is nil while the err is "no such file or directory".
-		if err != nil {
-			return err
-		}
+// DirInfoWithDst returns the dir info of the copy from dir to dst with the same options passed to [CopyDirWithOptions].
+// The unchanged files skipped by Options.Compare are not counted in FileCount and TotalSize.
+// dir: directory to get info.
+// dst: destination dir to compare the files.
+// opts: options of the copy. Leave it nil to use the default options.
+func DirInfoWithDst(dir, dst string, opts *Options) (*DirInfoData, error) {
+	return dirInfo(context.Background(), osSource{}, dir, dst, opts)
+}
 
-		// d is a dir.
-		if d.IsDir() {
-			di.SubDirCount += 1
-			return nil
-		}
+// DirInfoWithFilter returns the dir info of the files selected by the filter.
+// dir: directory to get info.
+// filter: filter to select the files. Leave it nil for all files.
+func DirInfoWithFilter(dir string, filter *Filter) (*DirInfoData, error) {
+	return dirInfo(context.Background(), osSource{}, dir, "", &Options{Filter: filter})
+}
 
-		// d is a file.
-		fi, err := d.Info()
-		if err != nil {
-			return err
-		}
+// CopyDirWithOptions copies files and sub-directories from src to dst recursively with options and returns the number of bytes copied.
+// It accepts [context.Context] to make copy cancalable.
+// ctx: context to stop the copy.
+// src: source dir.
+// dst: destination dir.
+// opts: options of the copy. Leave it nil to use the default options.
+func CopyDirWithOptions(ctx context.Context, src, dst string, opts *Options) (n int64, err error) {
+	return copyDir(ctx, osSource{}, src, dst, opts, nil)
+}
 
-		if len(di.Exts) > 0 {
-			for _, ext := range di.Exts {
-				if strings.ToLower(filepath.Ext(d.Name())) == ext {
-					di.FileCount += 1
-					di.TotalSize += fi.Size()
-					return nil
-				}
-			}
-			return nil
-		} else {
-			di.FileCount += 1
-			di.TotalSize += fi.Size()
-			return nil
-		}
-	})
+// CopyDirWithFilter copies the files selected by the filter and sub-directories from src to dst recursively and returns the number of bytes copied.
+// It accepts [context.Context] to make copy cancalable.
+// ctx: context to stop the copy.
+// src: source dir.
+// dst: destination dir.
+// filter: filter to select the files. Leave it nil for all files.
+func CopyDirWithFilter(ctx context.Context, src, dst string, filter *Filter) (n int64, err error) {
+	return copyDir(ctx, osSource{}, src, dst, &Options{Filter: filter}, nil)
+}
 
-	return di, err
+// ResumeCopyDir resumes the copy of [CopyDirWithOptions] from the checkpoint file specified by opts.Checkpoint.
+// It skips the completed files and continues the partially copied file.
+// It starts a new copy if the checkpoint file does not exist.
+// The checkpoint file is saved periodically while copying and when the copy stops with an error(e.g. context.Canceled),
+// and it's removed after the copy is done.
+// opts: options of the copy. It should be the same as the options of the stopped copy.
+func ResumeCopyDir(ctx context.Context, src, dst string, opts *Options) (n int64, err error) {
+	return resumeCopyDir(ctx, osSource{}, src, dst, opts)
 }
 
 // CopyDirBufferWithProgress copies files and sub-directories from src to dst recursively and returns the number of bytes of copied.
@@ -83,107 +113,792 @@ func CopyDirBufferWithProgress(
 	exts []string,
 	buf []byte,
 	fn iocopy.OnWrittenFunc) (n int64, err error) {
-	di, err := DirInfo(src, exts)
-	if err != nil {
-		return 0, err
+	return copyDir(ctx, osSource{}, src, dst, &Options{Exts: exts, Buf: buf, OnWritten: fn}, nil)
+}
+
+// CopyDir copies files and sub-directories from src to dst recursively and returns the number of bytes copied.
+// It accepts [context.Context] to make copy cancalable.
+// ctx: context to stop the copy.
+// src: source dir.
+// dst: destination dir.
+// exts: desired file extensions. Leave it nil or empty for all files.
+func CopyDir(ctx context.Context, src, dst string, exts []string) (n int64, err error) {
+	return CopyDirBufferWithProgress(ctx, src, dst, exts, nil, nil)
+}
+
+// CopyDirBuffer is buffered version of [CopyDir].
+func CopyDirBuffer(ctx context.Context, src, dst string, exts []string, buf []byte) (n int64, err error) {
+	return CopyDirBufferWithProgress(ctx, src, dst, exts, buf, nil)
+}
+
+// CopyDirWithProgress is non-buffered version of [CopyDirBufferWithProgress].
+func CopyDirWithProgress(
+	ctx context.Context,
+	src string,
+	dst string,
+	exts []string,
+	fn iocopy.OnWrittenFunc) (n int64, err error) {
+	return CopyDirBufferWithProgress(ctx, src, dst, exts, nil, fn)
+}
+
+// matchExts reports whether the extension of name matches one of the lower-cased exts.
+// It returns true if exts is empty.
+func matchExts(name string, exts []string) bool {
+	if len(exts) == 0 {
+		return true
 	}
 
-	totalSize := di.TotalSize
-	copied := int64(0)
+	for _, ext := range exts {
+		if strings.ToLower(filepath.Ext(name)) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerExts returns the lower-cased exts.
+func lowerExts(exts []string) []string {
+	var lower []string
+	for _, ext := range exts {
+		lower = append(lower, strings.ToLower(ext))
+	}
+	return lower
+}
 
-	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
-		// Check err first.
-		// d is nil while the err is "no such file or directory".
+// dirInfo returns the info of dir in the source.
+// dst: destination dir to compare the files by Options.Compare. Leave it empty to count all files.
+func dirInfo(ctx context.Context, s source, dir, dst string, opts *Options) (*DirInfoData, error) {
+	opts = opts.orDefault()
+	di := &DirInfoData{unchanged: map[string]bool{}}
+
+	di.Exts = lowerExts(opts.Exts)
+	if opts.Filter != nil && len(opts.Filter.Exts) > 0 {
+		di.Exts = lowerExts(opts.Filter.Exts)
+	}
+
+	f := newFileFilter(s, opts)
+
+	// Files with multiple hard links counted.
+	linked := map[fileID]bool{}
+
+	err := walk(s, dir, opts.Symlinks == SymlinkFollow, func(p string, fi fs.FileInfo) error {
+		rel, err := s.rel(dir, p)
 		if err != nil {
 			return err
 		}
 
-		// d is a dir.
-		if d.IsDir() {
-			// Create the dir even if the source dir is empty.
-			dstDir := pathelper.ReplacePrefix(path, src, dst)
-			return pathelper.CreateDirIfNotExists(dstDir, 0755)
+		// fi is a dir.
+		if fi.IsDir() {
+			if skip, err := f.walkDir(p, rel, fi); err != nil || skip {
+				if skip {
+					return fs.SkipDir
+				}
+				return err
+			}
+
+			di.SubDirCount += 1
+			return nil
+		}
+
+		// fi is a file or symlink.
+		if ok, err := f.matchFile(p, rel, fi); err != nil || !ok {
+			return err
+		}
+
+		if isSymlink(fi) {
+			if opts.Symlinks == SymlinkPreserve {
+				di.SymlinkCount += 1
+			}
+			return nil
+		}
+
+		if isSpecial(fi) {
+			switch opts.SpecialFiles {
+			case SpecialFileRecreate:
+				di.SpecialFileCount += 1
+			case SpecialFileError:
+				return specialFileError(p)
+			}
+			return nil
 		}
 
-		// d is a file.
-		// Check if file ext matches desired exts.
-		matched := false
-		if len(di.Exts) > 0 {
-			for _, ext := range di.Exts {
-				if strings.ToLower(filepath.Ext(d.Name())) == ext {
-					matched = true
-					break
+		if opts.HardLinks {
+			if id, ok := hardLinkID(fi); ok {
+				if linked[id] {
+					di.HardLinkCount += 1
+					return nil
 				}
+				linked[id] = true
 			}
-		} else {
-			matched = true
 		}
 
-		// Skip if ext is not matched.
-		if !matched {
-			return nil
+		// Do not count the unchanged files.
+		if dst != "" {
+			same, err := unchanged(ctx, s, p, filepath.Join(dst, filepath.FromSlash(rel)), fi, opts)
+			if err != nil {
+				return err
+			}
+
+			if same {
+				di.unchanged[rel] = true
+				return nil
+			}
+		}
+
+		di.FileCount += 1
+		di.TotalSize += fi.Size()
+		return nil
+	})
+
+	return di, err
+}
+
+// dirCopier copies a dir recursively.
+type dirCopier struct {
+	ctx  context.Context
+	s    source
+	src  string
+	dst  string
+	opts *Options
+	di   *DirInfoData
+	// Number of bytes copied.
+	copied int64
+	// Number of bytes done to report progress, including the skipped files.
+	done int64
+	// Dirs to preserve attributes after their contents are written.
+	dirs []dirAttrs
+	// Dst files of the copied files which have multiple hard links.
+	linked map[fileID]string
+	// Files with multiple hard links whose first names are skipped by the BeforeFile callback.
+	skipped map[fileID]bool
+	// Checkpoint to save. It's nil if Options.Checkpoint is not set.
+	ckpt *Checkpoint
+	// Completed files loaded from the checkpoint to resume.
+	resumed map[string]bool
+	// Time of the last checkpoint saved.
+	saved time.Time
+	// Relative paths of the regular files to write the manifest. It's nil if Options.Manifest is not set.
+	files []string
+	// SHA-256 checksums of the files computed while copying to write the manifest.
+	sums map[string][]byte
+	// Tracker of the progress events. It's nil if the events are not required.
+	pt *progressTracker
+	// Filter of the files and dirs.
+	f *fileFilter
+	// Dst files renamed by the BeforeFile callback to keep in the mirror copy.
+	renamed map[string]bool
+
+	// mu protects the states shared with the workers while copying files in parallel,
+	// and serializes the callbacks.
+	mu sync.Mutex
+	// Number of bytes written of the files being copied by the workers.
+	inflight int64
+	// Files to copy by the workers. It's nil if the files are copied sequentially.
+	jobs chan fileJob
+	// Workers copying files.
+	wg sync.WaitGroup
+	// Function to stop the workers on the first error.
+	cancel context.CancelFunc
+	// First error of the workers.
+	err error
+	// Hard links to create after the workers are done.
+	links []hardLinkJob
+	// Source and destination dirs to call AfterDir after the workers are done.
+	afterDirs [][2]string
+}
+
+// copyDir copies files and sub-directories from src of the source to dst recursively.
+// ckpt: checkpoint to resume the copy. Leave it nil to start a new copy.
+func copyDir(ctx context.Context, s source, src, dst string, opts *Options, ckpt *Checkpoint) (n int64, err error) {
+	opts = opts.orDefault()
+
+	// Compare the files with dst to count the files to transfer only.
+	di, err := dirInfo(ctx, s, src, dst, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// Feed the bytes written to the progress tracker.
+	pt := newProgressTracker(di, opts)
+	if pt != nil {
+		o := *opts
+		o.OnWritten = pt.onWritten(opts.OnWritten)
+		opts = &o
+	}
+
+	c := &dirCopier{
+		ctx:     ctx,
+		s:       s,
+		src:     src,
+		dst:     dst,
+		opts:    opts,
+		di:      di,
+		linked:  map[fileID]string{},
+		skipped: map[fileID]bool{},
+		resumed: map[string]bool{},
+		saved:   time.Now(),
+		sums:    map[string][]byte{},
+		pt:      pt,
+		f:       newFileFilter(s, opts),
+		renamed: map[string]bool{},
+	}
+
+	if opts.Checkpoint != "" {
+		c.ckpt = &Checkpoint{Src: src, Dst: dst}
+		if ckpt != nil {
+			for _, rel := range ckpt.Done {
+				c.resumed[rel] = true
+			}
+			c.ckpt.Done = ckpt.Done
+			c.ckpt.Current, c.ckpt.Offset = ckpt.Current, ckpt.Offset
+			c.ckpt.Size, c.ckpt.ModTime = ckpt.Size, ckpt.ModTime
+		}
+	}
+
+	// Delete the extraneous files in dst before copying.
+	if err = mirror(s, src, dst, opts, DeleteBefore, nil); err != nil {
+		return 0, err
+	}
+
+	if opts.Workers > 1 {
+		c.startWorkers(opts.Workers)
+	}
+
+	err = walkPost(s, src, opts.Symlinks == SymlinkFollow, c.walkFn, c.postFn)
+	if c.jobs != nil {
+		err = c.wait(err)
+	}
+
+	// Delete the extraneous files in dst after the copy is done.
+	if err == nil {
+		err = mirror(s, src, dst, opts, DeleteAfter, c.renamed)
+	}
+
+	if err != nil {
+		if c.ckpt != nil {
+			// Save the checkpoint to resume later.
+			if saveErr := c.ckpt.save(opts.Checkpoint); saveErr != nil {
+				err = errors.Join(err, saveErr)
+			}
 		}
+		return c.copied, err
+	}
 
-		fSrc, err := os.Open(path)
+	// Write the manifest before preserving the dir attributes,
+	// or the mtime of dst would be changed if the manifest is in dst.
+	if opts.Manifest != "" {
+		m, err := buildManifest(ctx, dst, c.files, c.sums, opts.Buf)
 		if err != nil {
+			return c.copied, err
+		}
+
+		if err = m.Save(opts.Manifest, opts.ManifestFormat); err != nil {
+			return c.copied, err
+		}
+	}
+
+	if err = preserveDirAttrs(c.dirs, opts.Preserve); err != nil {
+		return c.copied, err
+	}
+
+	// Remove the checkpoint after the copy is done.
+	if c.ckpt != nil {
+		if err = os.Remove(opts.Checkpoint); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return c.copied, err
+		}
+	}
+
+	if pt != nil {
+		pt.finish(ctx)
+	}
+
+	return c.copied, nil
+}
+
+// resumeCopyDir resumes the dir copy from the checkpoint file specified by opts.Checkpoint.
+// It starts a new copy if the checkpoint file does not exist.
+func resumeCopyDir(ctx context.Context, s source, src, dst string, opts *Options) (n int64, err error) {
+	opts = opts.orDefault()
+	if opts.Checkpoint == "" {
+		return copyDir(ctx, s, src, dst, opts, nil)
+	}
+
+	ckpt, err := loadCheckpointFor(opts.Checkpoint, src, dst)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return 0, err
+		}
+		ckpt = nil
+	}
+
+	return copyDir(ctx, s, src, dst, opts, ckpt)
+}
+
+// markDone records the completed file to the checkpoint
+// and saves the checkpoint if the interval elapsed.
+func (c *dirCopier) markDone(rel string) error {
+	if c.ckpt == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ckpt.Done = append(c.ckpt.Done, rel)
+	if c.ckpt.Current == rel {
+		c.ckpt.clearCurrent()
+	}
+	return c.saveIfDue()
+}
+
+// saveIfDue saves the checkpoint if the interval elapsed.
+func (c *dirCopier) saveIfDue() error {
+	interval := c.opts.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+
+	if time.Since(c.saved) < interval {
+		return nil
+	}
+
+	c.saved = time.Now()
+	return c.ckpt.save(c.opts.Checkpoint)
+}
+
+// walkFn copies the file or dir p.
+func (c *dirCopier) walkFn(p string, fi fs.FileInfo) error {
+	// Stop the walk if a worker failed.
+	if err := c.workerErr(); err != nil {
+		return err
+	}
+
+	rel, err := c.s.rel(c.src, p)
+	if err != nil {
+		return err
+	}
+
+	// Make dst file or dir name.
+	dstName := filepath.Join(c.dst, filepath.FromSlash(rel))
+
+	// fi is a dir.
+	if fi.IsDir() {
+		// Skip the excluded dir with its contents.
+		if skip, err := c.f.walkDir(p, rel, fi); err != nil || skip {
+			if skip {
+				return fs.SkipDir
+			}
 			return err
 		}
-		defer fSrc.Close()
 
-		// Make dst file name.
-		dstFile := pathelper.ReplacePrefix(path, src, dst)
-		fDst, err := os.Create(dstFile)
-		if err != nil {
+		// Create the dir even if the source dir is empty.
+		if err := pathelper.CreateDirIfNotExists(dstName, 0755); err != nil {
 			return err
 		}
-		defer fDst.Close()
-
-		n, err := iocopy.CopyBufferWithProgress(
-			// Context.
-			ctx,
-			// Dst.
-			fDst,
-			// Src.
-			fSrc,
-			// Buffer.
-			buf,
-			// Total size of all files in the dir.
-			totalSize,
-			// Bytes of copied files.
-			copied,
-			// Callback to report progress.
-			fn,
-		)
-		if err != nil {
+
+		if c.opts.Preserve != 0 {
+			c.dirs = append(c.dirs, dirAttrs{dst: dstName, fi: fi})
+		}
+		return nil
+	}
+
+	// fi is a file or symlink.
+	// Skip if it's filtered out.
+	if ok, err := c.f.matchFile(p, rel, fi); err != nil || !ok {
+		return err
+	}
+
+	// Skip the unchanged file before calling BeforeFile.
+	if c.di.unchanged[rel] {
+		return c.skipUnchanged(p, rel, dstName, fi)
+	}
+
+	// Let the callback skip the file or change the destination.
+	if c.opts.BeforeFile != nil {
+		op := &FileOp{Src: p, Dst: dstName, Info: fi}
+		if err := c.opts.beforeFile(op); err != nil {
 			return err
 		}
-		copied += n
+
+		if op.Skip {
+			return c.skipFile(p, rel, dstName, fi)
+		}
+
+		if op.Dst != dstName {
+			dstName = op.Dst
+			c.renamed[filepath.Clean(dstName)] = true
+			if err := pathelper.CreateDirIfNotExists(filepath.Dir(dstName), 0755); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Record the regular file to write the manifest.
+	if c.opts.Manifest != "" && fi.Mode().IsRegular() {
+		if mrel, ok := c.manifestPath(dstName); ok {
+			c.files = append(c.files, mrel)
+		}
+	}
+
+	// Skip the file completed before resuming.
+	if c.resumed[rel] {
+		if fi.Mode().IsRegular() {
+			if id, ok := hardLinkID(fi); ok && c.opts.HardLinks {
+				if _, ok := c.linked[id]; ok {
+					// It's a hard link which is not counted in TotalSize.
+					return nil
+				}
+
+				// The first name is skipped, so this name is not counted in TotalSize.
+				if c.skipped[id] {
+					c.addTotal(fi.Size())
+				}
+				c.linked[id] = dstName
+			}
+
+			c.startFile(p)
+
+			c.mu.Lock()
+			c.done += fi.Size()
+			c.mu.Unlock()
+		}
 		return nil
-	})
-	return copied, err
+	}
+
+	pending, err := c.copyEntry(p, rel, dstName, fi)
+	if err != nil || pending {
+		return err
+	}
+	return c.markDone(rel)
 }
 
-// CopyDir copies files and sub-directories from src to dst recursively and returns the number of bytes copied.
-// It accepts [context.Context] to make copy cancalable.
-// ctx: context to stop the copy.
-// src: source dir.
-// dst: destination dir.
-// exts: desired file extensions. Leave it nil or empty for all files.
-func CopyDir(ctx context.Context, src, dst string, exts []string) (n int64, err error) {
-	return CopyDirBufferWithProgress(ctx, src, dst, exts, nil, nil)
+// postFn calls the AfterDir callback after the entries of the dir p are walked.
+// The calls are delayed until the workers are done while copying files in parallel.
+func (c *dirCopier) postFn(p string, fi fs.FileInfo) error {
+	dstName, err := dstPath(c.s, c.src, c.dst, p)
+	if err != nil {
+		return err
+	}
+
+	if c.jobs != nil {
+		c.afterDirs = append(c.afterDirs, [2]string{p, dstName})
+		return nil
+	}
+	return c.opts.afterDir(p, dstName)
 }
 
-// CopyDirBuffer is buffered version of [CopyDir].
-func CopyDirBuffer(ctx context.Context, src, dst string, exts []string, buf []byte) (n int64, err error) {
-	return CopyDirBufferWithProgress(ctx, src, dst, exts, buf, nil)
+// skipFile skips the file p by the BeforeFile callback.
+func (c *dirCopier) skipFile(p, rel, dst string, fi fs.FileInfo) error {
+	// Count the skipped regular file as done to report progress.
+	// Only the first name of a file with multiple hard links is counted in TotalSize.
+	if fi.Mode().IsRegular() {
+		id, ok := hardLinkID(fi)
+		linked := ok && c.opts.HardLinks
+		if !linked || (c.linked[id] == "" && !c.skipped[id]) {
+			c.startFile(p)
+			c.addDone(fi.Size())
+		}
+
+		if linked {
+			c.skipped[id] = true
+		}
+	}
+
+	c.afterFile(&FileResult{Src: p, Dst: dst, Outcome: OutcomeSkipped})
+	return c.markDone(rel)
 }
 
-// CopyDirWithProgress is non-buffered version of [CopyDirBufferWithProgress].
-func CopyDirWithProgress(
-	ctx context.Context,
-	src string,
-	dst string,
-	exts []string,
-	fn iocopy.OnWrittenFunc) (n int64, err error) {
-	return CopyDirBufferWithProgress(ctx, src, dst, exts, nil, fn)
+// skipUnchanged skips the file p which is the same as dst by Options.Compare.
+// It's not counted in TotalSize, so it's not counted as done.
+func (c *dirCopier) skipUnchanged(p, rel, dst string, fi fs.FileInfo) error {
+	// dst is kept as the copy of p.
+	if c.opts.Manifest != "" {
+		if mrel, ok := c.manifestPath(dst); ok {
+			c.files = append(c.files, mrel)
+		}
+	}
+
+	// Link the following hard links of p to dst.
+	if id, ok := hardLinkID(fi); ok && c.opts.HardLinks {
+		c.linked[id] = dst
+	}
+
+	c.afterFile(&FileResult{Src: p, Dst: dst, Outcome: OutcomeSkipped})
+	if c.resumed[rel] {
+		return nil
+	}
+	return c.markDone(rel)
+}
+
+// manifestPath returns the slash-separated path of dst relative to the destination dir.
+// It returns false if dst is not in the destination dir.
+func (c *dirCopier) manifestPath(dst string) (string, bool) {
+	rel, err := filepath.Rel(c.dst, dst)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// copyEntry copies the file, symlink or special file p.
+// rel: slash-separated path of p relative to src.
+// pending: whether the copy is left to the workers, which mark the file done after it's copied.
+func (c *dirCopier) copyEntry(p, rel, dstName string, fi fs.FileInfo) (pending bool, err error) {
+	// fi is a symlink which is not followed.
+	if isSymlink(fi) {
+		if c.opts.Symlinks != SymlinkPreserve {
+			c.afterFile(&FileResult{Src: p, Dst: dstName, Outcome: OutcomeSkipped})
+			return false, nil
+		}
+
+		target, err := symlinkTarget(c.s, c.src, c.dst, p, c.opts.RewriteSymlinks)
+		if err != nil {
+			return false, err
+		}
+
+		return false, c.create(p, dstName, fi, func() error {
+			return createSymlink(target, dstName)
+		})
+	}
+
+	// fi is a special file. Never open it.
+	if isSpecial(fi) {
+		switch c.opts.SpecialFiles {
+		case SpecialFileRecreate:
+			return false, c.create(p, dstName, fi, func() error {
+				return createSpecial(dstName, fi)
+			})
+		case SpecialFileError:
+			return false, specialFileError(p)
+		}
+
+		c.afterFile(&FileResult{Src: p, Dst: dstName, Outcome: OutcomeSkipped})
+		return false, nil
+	}
+
+	// fi has multiple hard links.
+	if c.opts.HardLinks {
+		if id, ok := hardLinkID(fi); ok {
+			if target, ok := c.linked[id]; ok {
+				// The target may be being copied by a worker.
+				if c.jobs != nil {
+					c.links = append(c.links, hardLinkJob{src: p, rel: rel, dst: dstName, target: target, fi: fi})
+					return true, nil
+				}
+
+				return false, c.create(p, dstName, fi, func() error {
+					return createHardLink(target, dstName)
+				})
+			}
+
+			// The first name is skipped, so the content is copied for this name which is not counted in TotalSize.
+			if c.skipped[id] {
+				c.addTotal(fi.Size())
+			}
+			c.linked[id] = dstName
+		}
+	}
+
+	return c.copyFile(p, rel, dstName, fi)
+}
+
+// create creates dst which is not a regular file by fn and applies the attributes.
+func (c *dirCopier) create(src, dst string, fi fs.FileInfo, fn func() error) error {
+	start := time.Now()
+
+	outcome, err := prepareDst(dst, fi, c.opts.Overwrite)
+	if err == nil && outcome != OutcomeSkipped {
+		if err = fn(); err == nil {
+			err = preserveAttrs(dst, fi, c.opts.Preserve)
+		}
+	}
+
+	c.afterFile(&FileResult{Src: src, Dst: dst, Outcome: outcome, Duration: time.Since(start), Err: err})
+	return err
+}
+
+// copyFile copies the regular file src to dst.
+// rel: slash-separated path of src relative to the source dir.
+// pending: whether the copy is left to the workers.
+func (c *dirCopier) copyFile(src, rel, dst string, fi fs.FileInfo) (pending bool, err error) {
+	c.startFile(src)
+
+	// Offset to resume the copy.
+	offset := int64(0)
+	if c.ckpt != nil && c.ckpt.Current == rel && c.ckpt.Offset > 0 {
+		// Check if the source file is changed since the checkpoint.
+		if c.opts.ResumeCheck != ResumeCheckNone && (fi.Size() != c.ckpt.Size || !fi.ModTime().Equal(c.ckpt.ModTime)) {
+			return false, resumeMismatchError(src)
+		}
+
+		if c.ckpt.Offset <= fi.Size() {
+			offset = c.ckpt.Offset
+		}
+	}
+
+	// dst is expected to exist while resuming the copy.
+	outcome := OutcomeOverwritten
+	if offset == 0 {
+		if outcome, err = prepareDst(dst, fi, c.opts.Overwrite); err != nil {
+			c.afterFile(&FileResult{Src: src, Dst: dst, Outcome: outcome, Err: err})
+			return false, err
+		}
+	}
+
+	if outcome == OutcomeSkipped {
+		// Count the skipped file as done to report progress.
+		c.addDone(fi.Size())
+		c.afterFile(&FileResult{Src: src, Dst: dst, Outcome: outcome})
+		return false, nil
+	}
+
+	job := fileJob{src: src, rel: rel, dst: dst, fi: fi, offset: offset, outcome: outcome}
+
+	// Create fresh hashes for each file.
+	if c.opts.Hashes != nil {
+		job.hashes = c.opts.Hashes()
+	}
+
+	if c.jobs != nil {
+		return true, c.dispatch(job)
+	}
+	return false, c.writeFile(job)
+}
+
+// writeFile writes the regular file of the job sequentially.
+func (c *dirCopier) writeFile(job fileJob) error {
+	// Count the bytes copied before resuming as done.
+	c.done += job.offset
+
+	opts := c.opts
+	if c.ckpt != nil {
+		c.ckpt.Current, c.ckpt.Offset = job.rel, job.offset
+		c.ckpt.Size, c.ckpt.ModTime = job.fi.Size(), job.fi.ModTime()
+
+		// Wrap the callback to save the offset of the current file periodically.
+		o := *c.opts
+		o.OnWritten = func(total, prev, current int64, percent float32) {
+			c.ckpt.Offset = job.offset + current
+			c.saveIfDue()
+
+			if c.opts.OnWritten != nil {
+				c.opts.OnWritten(total, prev, current, percent)
+			}
+		}
+		opts = &o
+	}
+
+	n, _, err := c.write(job, c.di.TotalSize, c.done, opts)
+	c.copied += n
+	c.done += n
+	if err != nil {
+		if c.ckpt != nil {
+			c.ckpt.Offset = job.offset + n
+
+			// The temporary file is removed on failure, restart the file.
+			if c.opts.Atomic {
+				c.ckpt.Offset = 0
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// write copies the content of the job's file and reports the result to AfterFile.
+// total, prev: total size and number of bytes done to report progress.
+// opts: options of the copy with the wrapped callback.
+// written: whether dst is created, truncated or written.
+func (c *dirCopier) write(job fileJob, total, prev int64, opts *Options) (n int64, written bool, err error) {
+	start := time.Now()
+
+	// Compute the checksum for the manifest while copying.
+	var mh hash.Hash
+	all := job.hashes
+	if c.opts.Manifest != "" {
+		mh = sha256.New()
+		all = append(append([]hash.Hash{}, job.hashes...), mh)
+	}
+
+	n, sum, written, err := writeFile(
+		// Context.
+		c.ctx,
+		// Source.
+		c.s,
+		// Src file.
+		job.src,
+		// Dst file.
+		job.dst,
+		// Src file info.
+		job.fi,
+		// Offset to resume the copy.
+		job.offset,
+		// Total size to report progress.
+		total,
+		// Bytes done to report progress.
+		prev,
+		// Options.
+		opts,
+		// Hashes.
+		all,
+		// Dir copies do not copy a file in chunks.
+		nil,
+	)
+
+	r := &FileResult{Src: job.src, Dst: job.dst, Outcome: job.outcome, Bytes: n, Duration: time.Since(start), Err: err}
+	if err != nil {
+		c.afterFile(r)
+		return n, written, err
+	}
+
+	if mrel, ok := c.manifestPath(job.dst); ok && mh != nil {
+		c.mu.Lock()
+		c.sums[mrel] = mh.Sum(nil)
+		c.mu.Unlock()
+	}
+
+	r.Digest, r.Sums = sum, hashSums(job.hashes)
+	c.afterFile(r)
+	return n, written, nil
+}
+
+// addDone counts the bytes of the file not copied(e.g. skipped or completed before resuming) as done and reports the progress.
+func (c *dirCopier) addDone(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.done += n
+	reportProgress(c.opts.OnWritten, c.di.TotalSize, c.done, c.inflight)
+}
+
+// addTotal counts the file which is not counted in TotalSize to report progress.
+func (c *dirCopier) addTotal(size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.di.FileCount += 1
+	c.di.TotalSize += size
+	if c.pt != nil {
+		c.pt.addFile(size)
+	}
+}
+
+// startFile records the file started to copy for the progress events.
+func (c *dirCopier) startFile(p string) {
+	if c.pt == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pt.startFile(p)
+}
+
+// afterFile calls the AfterFile callback. The calls are serialized while copying files in parallel.
+func (c *dirCopier) afterFile(r *FileResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.opts.afterFile(r)
 }
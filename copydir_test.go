@@ -2,10 +2,14 @@ package cp_test
 
 import (
 	"context"
+	"io/fs"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/northbright/cp"
 	"github.com/northbright/iocopy"
@@ -137,3 +141,529 @@ func ExampleCopyDirBufferWithProgress() {
 
 	// Output:
 }
+
+func ExampleCopyDirWithOptions() {
+	// Make a source dir with an executable script.
+	src, err := os.MkdirTemp("", "cp-src")
+	if err != nil {
+		log.Printf("os.MkdirTemp() error: %v", err)
+		return
+	}
+	defer os.RemoveAll(src)
+
+	script := filepath.Join(src, "bin", "hello.sh")
+	os.MkdirAll(filepath.Dir(script), 0755)
+	os.WriteFile(script, []byte("#!/bin/sh\necho hello\n"), 0755)
+
+	dst := filepath.Join(os.TempDir(), "cp-dst")
+
+	n, err := cp.CopyDirWithOptions(
+		// Context.
+		context.Background(),
+		// Source dir.
+		src,
+		// Destination dir.
+		dst,
+		// Options.
+		&cp.Options{
+			// Preserve mode, times and ownership like "cp -a".
+			Preserve: cp.PreserveAll,
+		},
+	)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	fi, err := os.Stat(filepath.Join(dst, "bin", "hello.sh"))
+	if err != nil {
+		log.Printf("os.Stat() error: %v", err)
+		return
+	}
+	log.Printf("mode: %v, mtime: %v", fi.Mode(), fi.ModTime())
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithOptions_parallel() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	n, err := cp.CopyDirWithOptions(
+		// Context.
+		context.Background(),
+		// Source dir.
+		src,
+		// Destination dir.
+		dst,
+		// Options.
+		&cp.Options{
+			// Copy 4 files concurrently.
+			Workers: 4,
+			// The callback sees the aggregated bytes of all files.
+			OnWritten: func(total, prev, current int64, percent float32) {
+				log.Printf("%v / %v bytes copied, %.2f%% done", prev+current, total, percent)
+			},
+		},
+	)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithOptions_progress() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	n, err := cp.CopyDirWithOptions(
+		// Context.
+		context.Background(),
+		// Source dir.
+		src,
+		// Destination dir.
+		dst,
+		// Options.
+		&cp.Options{
+			// Report the current file, rate and ETA at most every 100ms.
+			OnProgress: func(p cp.Progress) {
+				log.Printf("file %v/%v %v: %v/%v bytes, %.2f%%, %.0f B/s, ETA: %v", p.FileIndex, p.FileCount, p.Path, p.Done, p.Total, p.Percent, p.Rate, p.ETA)
+			},
+			ProgressInterval: 100 * time.Millisecond,
+		},
+	)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithOptions_hooks() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	n, err := cp.CopyDirWithOptions(
+		// Context.
+		context.Background(),
+		// Source dir.
+		src,
+		// Destination dir.
+		dst,
+		// Options.
+		&cp.Options{
+			// Skip the files starting with "." and rename ".jpeg" to ".jpg".
+			BeforeFile: func(op *cp.FileOp) error {
+				if strings.HasPrefix(filepath.Base(op.Src), ".") {
+					op.Skip = true
+				}
+				if ext := filepath.Ext(op.Dst); ext == ".jpeg" {
+					op.Dst = strings.TrimSuffix(op.Dst, ext) + ".jpg"
+				}
+				return nil
+			},
+			// Log each file with bytes, duration and error.
+			AfterFile: func(r *cp.FileResult) {
+				log.Printf("%v -> %v: %v, %v bytes in %v, err: %v", r.Src, r.Dst, r.Outcome, r.Bytes, r.Duration, r.Err)
+			},
+			// Log each dir after its entries are copied.
+			AfterDir: func(src, dst string) error {
+				log.Printf("dir %v -> %v done", src, dst)
+				return nil
+			},
+		},
+	)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithOptions_filters() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	opts := &cp.Options{
+		// Copy the Markdown files under "assets/a" and the compressed tarballs.
+		Include: []cp.Rule{
+			{Glob: "a/**/*.md"},
+			{Regexp: regexp.MustCompile(`\.tar\.(gz|xz)$`)},
+		},
+		// Skip the dirs named "node_modules" at any depth with their contents.
+		Exclude: []cp.Rule{
+			{Glob: "node_modules/"},
+		},
+	}
+
+	// DirInfoWithOptions applies the same rules.
+	di, err := cp.DirInfoWithOptions(src, opts)
+	if err != nil {
+		log.Printf("cp.DirInfoWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("%v files, total size: %v", di.FileCount, di.TotalSize)
+
+	n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithFilter() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	filter := &cp.Filter{
+		// Copy the Markdown files.
+		Exts: []string{".md"},
+		// Skip empty files and files larger than 1 MiB.
+		MinSize: 1,
+		MaxSize: 1024 * 1024,
+		// Skip hidden files and dirs.
+		SkipHidden: true,
+		// Skip the dir "b" with its contents.
+		Match: func(path string, d fs.DirEntry) bool {
+			return !(d.IsDir() && path == "b")
+		},
+	}
+
+	// DirInfoWithFilter applies the same filter.
+	di, err := cp.DirInfoWithFilter(src, filter)
+	if err != nil {
+		log.Printf("cp.DirInfoWithFilter() error: %v", err)
+		return
+	}
+	log.Printf("%v files, total size: %v", di.FileCount, di.TotalSize)
+
+	n, err := cp.CopyDirWithFilter(context.Background(), src, dst, filter)
+	if err != nil {
+		log.Printf("cp.CopyDirWithFilter() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithFilter() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithFilter_mimeTypes() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	filter := &cp.Filter{
+		// Copy all images and plain text files regardless of the file names.
+		// The MIME types are detected by sniffing the content.
+		MIMETypes: []string{"image/*", "text/plain"},
+	}
+
+	n, err := cp.CopyDirWithFilter(context.Background(), src, dst, filter)
+	if err != nil {
+		log.Printf("cp.CopyDirWithFilter() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithFilter() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithOptions_incremental() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	opts := &cp.Options{
+		// Skip the files which have the same size and modification time in dst.
+		Compare: cp.CompareSizeModTime,
+		// Preserve the modification times to compare them in the following copies.
+		Preserve: cp.PreserveTimes,
+		// The progress is computed only over the files to transfer.
+		OnWritten: func(total, prev, current int64, percent float32) {
+			log.Printf("%v / %v bytes written, %.2f%%", prev+current, total, percent)
+		},
+	}
+
+	// Copy all files.
+	n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Copy again and the unchanged files are skipped.
+	n, err = cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithOptions_mirror() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	// Make an extraneous file in dst which does not exist in src.
+	os.MkdirAll(dst, 0755)
+	os.WriteFile(filepath.Join(dst, "old.txt"), []byte("old\n"), 0644)
+
+	opts := &cp.Options{
+		// Delete the extraneous files in dst after copying.
+		Delete: cp.DeleteAfter,
+		// Never delete the files with ".keep" extension.
+		Protect: []cp.Rule{
+			{Glob: "*.keep"},
+		},
+		// Move the deleted files into the trash dir instead of removing them.
+		Trash: filepath.Join(dst, ".trash"),
+		// Log the deleted files.
+		AfterFile: func(r *cp.FileResult) {
+			if r.Outcome == cp.OutcomeDeleted {
+				log.Printf("%v: %v", r.Outcome, r.Dst)
+			}
+		},
+	}
+
+	n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExamplePlanCopyDir() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+
+	opts := &cp.Options{
+		// Skip existing destination files.
+		Overwrite: cp.OverwriteSkip,
+	}
+
+	// Plan the copy without touching dst.
+	plan, err := cp.PlanCopyDir(src, dst, opts)
+	if err != nil {
+		log.Printf("cp.PlanCopyDir() error: %v", err)
+		return
+	}
+
+	for _, e := range plan.Entries {
+		log.Printf("%v %v: %v, %v bytes", e.Action, e.Type, e.Path, e.Size)
+	}
+	log.Printf("%v files and %v dirs to create, total size: %v", plan.FileCount, plan.DirCount, plan.TotalSize)
+
+	// Execute the plan later.
+	n, err := plan.Execute(context.Background())
+	if err != nil {
+		log.Printf("plan.Execute() error: %v", err)
+		return
+	}
+	log.Printf("plan.Execute() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithOptions_ignoreFile() {
+	// Make a source dir with ignore files.
+	src, err := os.MkdirTemp("", "cp-src")
+	if err != nil {
+		log.Printf("os.MkdirTemp() error: %v", err)
+		return
+	}
+	defer os.RemoveAll(src)
+
+	os.MkdirAll(filepath.Join(src, "build"), 0755)
+	os.MkdirAll(filepath.Join(src, "logs"), 0755)
+	os.WriteFile(filepath.Join(src, "README.md"), []byte("# README\n"), 0644)
+	os.WriteFile(filepath.Join(src, "build", "app"), []byte("app\n"), 0644)
+	os.WriteFile(filepath.Join(src, "logs", "debug.log"), []byte("debug\n"), 0644)
+	os.WriteFile(filepath.Join(src, "logs", "keep.log"), []byte("keep\n"), 0644)
+
+	// Skip the "build" dir and the log files.
+	os.WriteFile(filepath.Join(src, ".cpignore"), []byte("build/\n*.log\n"), 0644)
+	// Re-include "keep.log" in "logs" only.
+	os.WriteFile(filepath.Join(src, "logs", ".cpignore"), []byte("!keep.log\n"), 0644)
+
+	dst := filepath.Join(os.TempDir(), "cp-dst")
+
+	opts := &cp.Options{
+		// Name of the ignore files in gitignore syntax.
+		IgnoreFile: ".cpignore",
+	}
+
+	// DirInfoWithOptions applies the same ignore files.
+	di, err := cp.DirInfoWithOptions(src, opts)
+	if err != nil {
+		log.Printf("cp.DirInfoWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("%v files, total size: %v", di.FileCount, di.TotalSize)
+
+	n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleCopyDirWithOptions_symlinks() {
+	// Make a source dir with a symlink.
+	src, err := os.MkdirTemp("", "cp-src")
+	if err != nil {
+		log.Printf("os.MkdirTemp() error: %v", err)
+		return
+	}
+	defer os.RemoveAll(src)
+
+	os.WriteFile(filepath.Join(src, "README.md"), []byte("# README\n"), 0644)
+	os.Symlink("README.md", filepath.Join(src, "README"))
+
+	dst := filepath.Join(os.TempDir(), "cp-dst")
+
+	n, err := cp.CopyDirWithOptions(
+		// Context.
+		context.Background(),
+		// Source dir.
+		src,
+		// Destination dir.
+		dst,
+		// Options.
+		&cp.Options{
+			// Recreate symlinks as symlinks.
+			Symlinks: cp.SymlinkPreserve,
+		},
+	)
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	target, err := os.Readlink(filepath.Join(dst, "README"))
+	if err != nil {
+		log.Printf("os.Readlink() error: %v", err)
+		return
+	}
+	log.Printf("README -> %v", target)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleResumeCopyDir() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+	checkpoint := filepath.Join(os.TempDir(), "cp-assets.json")
+
+	opts := &cp.Options{
+		// Save the checkpoint while copying and when the copy stops.
+		Checkpoint: checkpoint,
+	}
+
+	// Emulate user cancelation to stop the copy.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	n, err := cp.CopyDirWithOptions(ctx, src, dst, opts)
+	if err != nil {
+		if err != context.Canceled && err != context.DeadlineExceeded {
+			log.Printf("cp.CopyDirWithOptions() error: %v", err)
+			return
+		}
+		log.Printf("cp.CopyDirWithOptions() stopped, cause: %v. %v bytes copied", err, n)
+	}
+
+	// Resume the copy from the checkpoint.
+	n2, err := cp.ResumeCopyDir(context.Background(), src, dst, opts)
+	if err != nil {
+		log.Printf("cp.ResumeCopyDir() error: %v", err)
+		return
+	}
+	log.Printf("cp.ResumeCopyDir() OK, total %v bytes copied", n+n2)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
+
+func ExampleVerifyManifest() {
+	src := "assets"
+	dst := filepath.Join(os.TempDir(), "cp-assets")
+	manifest := filepath.Join(dst, "SHA256SUMS")
+
+	// Write the checksums of the copied files to the manifest in sha256sum format.
+	n, err := cp.CopyDirWithOptions(context.Background(), src, dst, &cp.Options{Manifest: manifest})
+	if err != nil {
+		log.Printf("cp.CopyDirWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyDirWithOptions() OK, %v bytes copied", n)
+
+	// Verify dst against the manifest.
+	r, err := cp.VerifyManifest(context.Background(), dst, manifest, nil)
+	if err != nil {
+		log.Printf("cp.VerifyManifest() error: %v", err)
+		return
+	}
+	log.Printf("cp.VerifyManifest() OK: %v, missing: %v, extra: %v, mismatched: %v", r.OK(), r.Missing, r.Extra, r.Mismatched)
+
+	// Remove dst dir after test.
+	os.RemoveAll(dst)
+
+	// Output:
+}
@@ -3,8 +3,12 @@ package cp
 import (
 	"context"
 	"errors"
+	"hash"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/northbright/iocopy"
 	"github.com/northbright/pathelper"
@@ -15,6 +19,42 @@ var (
 	ErrNotRegularFile = errors.New("not a regular file")
 )
 
+// CopyFileWithOptions copies file from src to dst with options and returns the number of bytes copied.
+// It accepts [context.Context] to make copy cancalable.
+// copied: number of bytes copied previously. See [CopyFileBufferWithProgress] for how to resume the copy.
+// opts: options of the copy. Leave it nil to use the default options.
+func CopyFileWithOptions(ctx context.Context, src, dst string, copied int64, opts *Options) (n int64, err error) {
+	n, _, err = copyFile(ctx, osSource{}, src, dst, copied, opts, nil, nil)
+	return n, err
+}
+
+// ResumeCopyFile resumes the copy of [CopyFileWithOptions] in chunks from the checkpoint file specified by opts.Checkpoint.
+// It skips the completed chunks and copies the others.
+// It starts a new copy if the checkpoint file does not exist.
+// The checkpoint file is saved periodically while copying and when the copy stops with an error(e.g. context.Canceled),
+// and it's removed after the copy is done.
+// opts: options of the copy. It should be the same as the options of the stopped copy.
+func ResumeCopyFile(ctx context.Context, src, dst string, opts *Options) (n int64, err error) {
+	return resumeCopyFile(ctx, osSource{}, src, dst, opts)
+}
+
+// CopyFileWithHashes copies file from src to dst with options and returns the number of bytes copied and the checksums.
+// It writes the content of src to the hashes while copying, so it does not read the file again to compute the checksums.
+// It accepts [context.Context] to make copy cancalable.
+// copied: number of bytes copied previously. The first copied bytes are read from src to compute the checksums.
+// hashes: hashes to write the content of src.
+// opts: options of the copy. Leave it nil to use the default options.
+// sums: checksums of the hashes in the same order. It's nil if the file is skipped.
+func CopyFileWithHashes(
+	ctx context.Context,
+	src string,
+	dst string,
+	copied int64,
+	hashes []hash.Hash,
+	opts *Options) (n int64, sums [][]byte, err error) {
+	return copyFile(ctx, osSource{}, src, dst, copied, opts, hashes, nil)
+}
+
 // CopyFileBufferWithProgress copies file from src to dst and returns the number of bytes copied.
 // It accepts [context.Context] to make copy cancalable.
 // It also accepts callback function on bytes written to report progress.
@@ -32,78 +72,437 @@ func CopyFileBufferWithProgress(
 	buf []byte,
 	copied int64,
 	fn iocopy.OnWrittenFunc) (n int64, err error) {
+	n, _, err = copyFile(ctx, osSource{}, src, dst, copied, &Options{Buf: buf, OnWritten: fn, Symlinks: SymlinkSkip}, nil, nil)
+	return n, err
+}
+
+// CopyFile copies file from src to dst and returns the number of bytes copied.
+// It accepts [context.Context] to make copy cancalable.
+func CopyFile(ctx context.Context, src, dst string) (n int64, err error) {
+	return CopyFileBufferWithProgress(ctx, src, dst, nil, 0, nil)
+}
+
+// CopyFileBuffer is buffered version of [CopyFile].
+func CopyFileBuffer(ctx context.Context, src, dst string, buf []byte) (n int64, err error) {
+	return CopyFileBufferWithProgress(ctx, src, dst, buf, 0, nil)
+}
+
+// CopyFileWithProgress is non-buffered version of [CopyFileBufferWithProgress].
+func CopyFileWithProgress(
+	ctx context.Context,
+	src string,
+	dst string,
+	copied int64,
+	fn iocopy.OnWrittenFunc) (n int64, err error) {
+	return CopyFileBufferWithProgress(ctx, src, dst, nil, copied, fn)
+}
+
+// copyFile copies file from src of the source to dst.
+// hashes: hashes to write the content of src. Leave it nil to use the hashes created by Options.Hashes.
+// ckpt: checkpoint to resume the file copied in chunks. Leave it nil to start a new copy.
+// It returns the checksums of the hashes if the file is written.
+func copyFile(
+	ctx context.Context,
+	s source,
+	src string,
+	dst string,
+	copied int64,
+	opts *Options,
+	hashes []hash.Hash,
+	ckpt *Checkpoint) (n int64, sums [][]byte, err error) {
+	opts = opts.orDefault()
+
 	// Get src file info.
-	fi, err := os.Lstat(src)
+	fi, err := s.lstat(src)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+
+	if isSymlink(fi) {
+		switch opts.Symlinks {
+		case SymlinkFollow:
+			if fi, err = s.stat(src); err != nil {
+				return 0, nil, err
+			}
+		case SymlinkPreserve:
+			return 0, nil, copySymlink(s, src, dst, fi, opts)
+		}
 	}
 
 	// Check if src's a regular file.
 	if !fi.Mode().IsRegular() {
-		return 0, ErrNotRegularFile
+		return 0, nil, s.errNotRegular()
 	}
 
-	// Get the source file's size.
-	size := fi.Size()
-
 	// Make dest file's dir if it does not exist.
 	dir := filepath.Dir(dst)
 	if err := pathelper.CreateDirIfNotExists(dir, 0755); err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+
+	if copied < 0 {
+		copied = 0
+	}
+
+	if hashes == nil && opts.Hashes != nil {
+		hashes = opts.Hashes()
+	}
+
+	// Copy the file in chunks concurrently if the content is not processed sequentially.
+	var ck *chunkState
+	if copied == 0 && !opts.Sparse && opts.Verify == HashNone && len(hashes) == 0 {
+		if ck, err = newChunkState(src, dst, fi, opts, ckpt); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// dst is expected to exist while resuming the copy.
+	outcome := OutcomeOverwritten
+	if copied == 0 && (ck == nil || !ck.resume) {
+		if outcome, err = prepareDst(dst, fi, opts.Overwrite); err != nil {
+			opts.afterFile(&FileResult{Src: src, Dst: dst, Outcome: outcome, Err: err})
+			return 0, nil, err
+		}
+
+		if outcome == OutcomeSkipped {
+			opts.afterFile(&FileResult{Src: src, Dst: dst, Outcome: outcome})
+			return 0, nil, nil
+		}
+	}
+
+	start := time.Now()
+
+	n, sum, _, err := writeFile(ctx, s, src, dst, fi, copied, fi.Size(), copied, opts, hashes, ck)
+	if err != nil {
+		if ck != nil {
+			// Save the checkpoint to resume later.
+			if saveErr := ck.save(); saveErr != nil {
+				err = errors.Join(err, saveErr)
+			}
+		}
+
+		opts.afterFile(&FileResult{Src: src, Dst: dst, Outcome: outcome, Bytes: n, Duration: time.Since(start), Err: err})
+		return n, nil, err
+	}
+
+	// Remove the checkpoint after the copy is done.
+	if ck != nil {
+		if err = ck.remove(); err != nil {
+			return n, nil, err
+		}
+	}
+
+	sums = hashSums(hashes)
+	opts.afterFile(&FileResult{Src: src, Dst: dst, Outcome: outcome, Bytes: n, Duration: time.Since(start), Digest: sum, Sums: sums})
+	return n, sums, nil
+}
+
+// copySymlink recreates the symlink src as dst.
+func copySymlink(s source, src, dst string, fi fs.FileInfo, opts *Options) error {
+	target, err := s.readLink(src)
+	if err != nil {
+		return err
+	}
+
+	// Make dest symlink's dir if it does not exist.
+	dir := filepath.Dir(dst)
+	if err := pathelper.CreateDirIfNotExists(dir, 0755); err != nil {
+		return err
 	}
 
-	fSrc, err := os.Open(src)
+	outcome, err := prepareDst(dst, fi, opts.Overwrite)
+	if err == nil && outcome != OutcomeSkipped {
+		if err = createSymlink(target, dst); err == nil {
+			err = preserveAttrs(dst, fi, opts.Preserve)
+		}
+	}
+
+	opts.afterFile(&FileResult{Src: src, Dst: dst, Outcome: outcome, Err: err})
+	return err
+}
+
+// writeFile copies the content of src to dst and applies the preserved attributes.
+// It returns the checksum of src if Options.Verify is set.
+// fi: file info of src.
+// offset: offset of src and dst to resume the copy.
+// total: total number of bytes to report progress.
+// prev: number of bytes copied previously to report progress.
+// hashes: hashes to write the content of src.
+// ck: state to copy the file in chunks. Leave it nil to copy the file sequentially.
+// written: whether dst is created, truncated or written. It's false if the copy fails before dst is changed.
+func writeFile(
+	ctx context.Context,
+	s source,
+	src string,
+	dst string,
+	fi fs.FileInfo,
+	offset int64,
+	total int64,
+	prev int64,
+	opts *Options,
+	hashes []hash.Hash,
+	ck *chunkState) (n int64, sum []byte, written bool, err error) {
+	fSrc, err := s.open(src)
 	if err != nil {
-		return 0, err
+		return 0, nil, false, err
 	}
 	defer fSrc.Close()
 
+	// Chunks are copied with ReadAt.
+	ra, ok := fSrc.(io.ReaderAt)
+	if ck != nil && !ok {
+		// dst is rewritten sequentially, so none of the chunks are completed.
+		ck.reset()
+		ck = nil
+	}
+
+	// Hash to compute the checksum of src to verify.
+	h := opts.Verify.New()
+
+	// Writer of the hashes to receive the content of src.
+	var w io.Writer
+	if h != nil || len(hashes) > 0 {
+		var writers []io.Writer
+		if h != nil {
+			writers = append(writers, h)
+		}
+		for _, hh := range hashes {
+			writers = append(writers, hh)
+		}
+		w = io.MultiWriter(writers...)
+	}
+
 	var fDst *os.File
 
-	if copied > 0 {
-		if fDst, err = os.OpenFile(dst, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
-			return 0, err
+	switch {
+	case opts.Atomic:
+		// The temporary file is removed on failure, so there's nothing to resume.
+		if offset > 0 {
+			return 0, nil, false, &fs.PathError{Op: "resume", Path: dst, Err: errors.ErrUnsupported}
 		}
-		defer fDst.Close()
 
-		if _, err = fSrc.Seek(copied, 0); err != nil {
-			return 0, err
+		if fDst, err = createTemp(dst); err != nil {
+			return 0, nil, false, err
+		}
+	case ck != nil && ck.resume:
+		// Keep the completed chunks.
+		if fDst, err = os.OpenFile(dst, os.O_WRONLY, 0644); err != nil {
+			return 0, nil, false, err
+		}
+	case offset > 0:
+		// dst is not created if it's checked, so a missing dst is not left after the mismatch.
+		flag := os.O_CREATE | os.O_WRONLY
+		if opts.ResumeCheck != ResumeCheckNone {
+			if err = checkResumeSize(dst, offset); err != nil {
+				return 0, nil, false, err
+			}
+			flag = os.O_WRONLY
 		}
 
-		if _, err = fDst.Seek(copied, 0); err != nil {
-			return 0, err
+		if fDst, err = os.OpenFile(dst, flag, 0644); err != nil {
+			return 0, nil, false, err
 		}
-	} else {
-		if copied < 0 {
-			copied = 0
+
+		// Verify the prefix or skip it to resume the copy.
+		// The prefix is hashed to compute the checksum of the whole src.
+		if opts.ResumeCheck == ResumeCheckHash {
+			err = verifyPrefix(ctx, fSrc, dst, offset, opts.Buf, w)
+		} else {
+			err = skipPrefix(ctx, fSrc, offset, opts.Buf, w)
+		}
+		if err != nil {
+			fDst.Close()
+			return 0, nil, false, err
 		}
 
+		if _, err = fDst.Seek(offset, io.SeekStart); err != nil {
+			fDst.Close()
+			return 0, nil, false, err
+		}
+	default:
 		if fDst, err = os.Create(dst); err != nil {
-			return 0, err
+			return 0, nil, false, err
+		}
+	}
+
+	// Close dst and remove the temporary file on failure.
+	abort := func() {
+		if opts.Atomic {
+			removeTemp(fDst)
+		} else {
+			fDst.Close()
+		}
+	}
+
+	// Compute the checksums while copying.
+	// Kernel fast paths are not used because the content has to go through the user space.
+	r := io.Reader(fSrc)
+	if w != nil {
+		r = io.TeeReader(fSrc, w)
+	}
+
+	if ck != nil {
+		if err = preallocate(fDst, fi.Size()); err == nil {
+			n, err = copyChunks(ctx, fDst, ra, fi.Size(), total, prev, opts, ck)
+		}
+	} else {
+		n, err = copyContent(ctx, fDst, r, fi.Size(), offset, total, prev, opts)
+	}
+	if err != nil {
+		abort()
+		return n, nil, true, err
+	}
+
+	// Remove the stale bytes after the end if dst was longer.
+	if offset > 0 {
+		if err = fDst.Truncate(offset + n); err != nil {
+			abort()
+			return n, nil, true, err
 		}
-		defer fDst.Close()
 	}
 
-	return iocopy.CopyBufferWithProgress(ctx, fDst, fSrc, buf, size, copied, fn)
+	// Always flush dst before verifying it.
+	if opts.Sync || h != nil {
+		if err = fDst.Sync(); err != nil {
+			abort()
+			return n, nil, true, err
+		}
+	}
+
+	// Name of the file written.
+	name := dst
+	if opts.Atomic {
+		if name, err = linkTemp(fDst, dst); err != nil {
+			abort()
+			return n, nil, true, err
+		}
+	}
+
+	// Close dst before applying the attributes.
+	if err = fDst.Close(); err != nil {
+		if opts.Atomic {
+			os.Remove(name)
+		}
+		return n, nil, true, err
+	}
+
+	// Re-read dst to verify it.
+	if h != nil {
+		sum = h.Sum(nil)
+		if err = verifyFile(ctx, name, dst, opts.Verify, sum, opts.Buf); err != nil {
+			if opts.Atomic {
+				os.Remove(name)
+			}
+			return n, nil, true, err
+		}
+	}
+
+	if err = preserveAttrs(name, fi, opts.Preserve); err != nil {
+		if opts.Atomic {
+			os.Remove(name)
+		}
+		return n, nil, true, err
+	}
+
+	if opts.Atomic {
+		// Rename the temporary file to dst after the content and attributes are ready.
+		if err = os.Rename(name, dst); err != nil {
+			os.Remove(name)
+			return n, nil, true, err
+		}
+
+		if opts.Sync {
+			if err = syncDir(filepath.Dir(dst)); err != nil {
+				return n, nil, true, err
+			}
+		}
+	}
+
+	return n, sum, true, nil
 }
 
-// CopyFile copies file from src to dst and returns the number of bytes copied.
-// It accepts [context.Context] to make copy cancalable.
-func CopyFile(ctx context.Context, src, dst string) (n int64, err error) {
-	return CopyFileBufferWithProgress(ctx, src, dst, nil, 0, nil)
+// copyContent copies the content of the opened src to dst from offset.
+// It tries kernel fast paths first, then copies sparsely or through the user-space buffer.
+// Kernel fast paths and SEEK_DATA are only available when src is an [*os.File].
+// size: size of src.
+func copyContent(
+	ctx context.Context,
+	dst *os.File,
+	src io.Reader,
+	size int64,
+	offset int64,
+	total int64,
+	prev int64,
+	opts *Options) (n int64, err error) {
+	if opts.FastPath != FastPathNever {
+		n, err = copyFast(ctx, dst, src, offset, size, total, prev, opts.OnWritten, !opts.Sparse)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return n, err
+		}
+
+		if opts.FastPath == FastPathForce {
+			return 0, ErrFastPathUnavailable
+		}
+	}
+
+	if opts.Sparse {
+		return copySparse(ctx, dst, src, opts.Buf, offset, size, total, prev, opts.OnWritten)
+	}
+	return iocopy.CopyBufferWithProgress(ctx, dst, src, opts.Buf, total, prev, opts.OnWritten)
 }
 
-// CopyFileBuffer is buffered version of [CopyFile].
-func CopyFileBuffer(ctx context.Context, src, dst string, buf []byte) (n int64, err error) {
-	return CopyFileBufferWithProgress(ctx, src, dst, buf, 0, nil)
+// skipPrefix skips the first offset bytes of src to resume the copy.
+// It seeks src if src implements [io.Seeker] and w is nil, or reads the bytes and writes them to w.
+// w: writer to receive the bytes skipped. Leave it nil to discard the bytes.
+func skipPrefix(ctx context.Context, src fs.File, offset int64, buf []byte, w io.Writer) error {
+	if w == nil {
+		if seeker, ok := src.(io.Seeker); ok {
+			_, err := seeker.Seek(offset, io.SeekStart)
+			return err
+		}
+		w = io.Discard
+	}
+
+	n, err := iocopy.CopyBuffer(ctx, w, io.LimitReader(src, offset), buf)
+	if err != nil {
+		return err
+	}
+
+	if n < offset {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
 }
 
-// CopyFileWithProgress is non-buffered version of [CopyFileBufferWithProgress].
-func CopyFileWithProgress(
-	ctx context.Context,
-	src string,
-	dst string,
-	copied int64,
-	fn iocopy.OnWrittenFunc) (n int64, err error) {
-	return CopyFileBufferWithProgress(ctx, src, dst, nil, copied, fn)
+// hashSums returns the checksums of the hashes.
+// It returns nil if there're no hashes.
+func hashSums(hashes []hash.Hash) [][]byte {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	sums := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		sums[i] = h.Sum(nil)
+	}
+	return sums
+}
+
+// resumeCopyFile resumes the file copied in chunks from the checkpoint file specified by opts.Checkpoint.
+// It starts a new copy if the checkpoint file does not exist.
+func resumeCopyFile(ctx context.Context, s source, src, dst string, opts *Options) (n int64, err error) {
+	opts = opts.orDefault()
+
+	var ckpt *Checkpoint
+	if opts.Checkpoint != "" {
+		if ckpt, err = loadCheckpointFor(opts.Checkpoint, src, dst); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return 0, err
+			}
+			ckpt = nil
+		}
+	}
+
+	n, _, err = copyFile(ctx, s, src, dst, 0, opts, nil, ckpt)
+	return n, err
 }
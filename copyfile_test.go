@@ -2,6 +2,9 @@ package cp_test
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"hash"
 	"io"
 	"log"
 	"net/http"
@@ -123,3 +126,116 @@ func ExampleCopyFileBufferWithProgress() {
 
 	// Output:
 }
+
+func ExampleCopyFileWithOptions() {
+	src := filepath.Join(os.TempDir(), "cp-src.txt")
+	dst := filepath.Join(os.TempDir(), "cp-dst.txt")
+	os.WriteFile(src, []byte("Hello, World!\n"), 0644)
+	os.WriteFile(dst, []byte("Old content\n"), 0644)
+
+	n, err := cp.CopyFileWithOptions(
+		// Context.
+		context.Background(),
+		// Source file.
+		src,
+		// Destination file.
+		dst,
+		// Number of bytes copied previously.
+		0,
+		// Options.
+		&cp.Options{
+			// Rename the existing dst to "cp-dst.txt~" before writing.
+			Overwrite: cp.OverwriteBackup,
+			// Report the outcome.
+			AfterFile: func(r *cp.FileResult) {
+				log.Printf("%v -> %v: %v", r.Src, r.Dst, r.Outcome)
+			},
+		},
+	)
+	if err != nil {
+		log.Printf("cp.CopyFileWithOptions() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyFileWithOptions() OK, %v bytes copied", n)
+
+	// Remove the files after test's done.
+	os.Remove(src)
+	os.Remove(dst)
+	os.Remove(dst + "~")
+
+	// Output:
+}
+
+func ExampleCopyFileWithHashes() {
+	src := filepath.Join(os.TempDir(), "cp-src.txt")
+	dst := filepath.Join(os.TempDir(), "cp-dst.txt")
+	os.WriteFile(src, []byte("Hello, World!\n"), 0644)
+
+	n, sums, err := cp.CopyFileWithHashes(
+		// Context.
+		context.Background(),
+		// Source file.
+		src,
+		// Destination file.
+		dst,
+		// Number of bytes copied previously.
+		0,
+		// Compute SHA-256 and MD5 checksums while copying.
+		[]hash.Hash{sha256.New(), md5.New()},
+		// Options.
+		nil,
+	)
+	if err != nil {
+		log.Printf("cp.CopyFileWithHashes() error: %v", err)
+		return
+	}
+	log.Printf("cp.CopyFileWithHashes() OK, %v bytes copied, SHA-256: %x, MD5: %x", n, sums[0], sums[1])
+
+	// Remove the files after test's done.
+	os.Remove(src)
+	os.Remove(dst)
+
+	// Output:
+}
+
+func ExampleResumeCopyFile() {
+	src := filepath.Join(os.TempDir(), "cp-src.bin")
+	dst := filepath.Join(os.TempDir(), "cp-dst.bin")
+	checkpoint := filepath.Join(os.TempDir(), "cp-dst.bin.json")
+	os.WriteFile(src, make([]byte, 4*1024*1024), 0644)
+
+	opts := &cp.Options{
+		// Copy 4 chunks of 1 MiB concurrently.
+		ChunkWorkers: 4,
+		ChunkSize:    1024 * 1024,
+		// Save the completed chunks while copying and when the copy stops.
+		Checkpoint: checkpoint,
+	}
+
+	// Emulate user cancelation to stop the copy.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	n, err := cp.CopyFileWithOptions(ctx, src, dst, 0, opts)
+	if err != nil {
+		if err != context.Canceled && err != context.DeadlineExceeded {
+			log.Printf("cp.CopyFileWithOptions() error: %v", err)
+			return
+		}
+		log.Printf("cp.CopyFileWithOptions() stopped, cause: %v. %v bytes copied", err, n)
+	}
+
+	// Resume the copy from the checkpoint.
+	n2, err := cp.ResumeCopyFile(context.Background(), src, dst, opts)
+	if err != nil {
+		log.Printf("cp.ResumeCopyFile() error: %v", err)
+		return
+	}
+	log.Printf("cp.ResumeCopyFile() OK, total %v bytes copied", n+n2)
+
+	// Remove the files after test's done.
+	os.Remove(src)
+	os.Remove(dst)
+
+	// Output:
+}
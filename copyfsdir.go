@@ -3,58 +3,58 @@ package cp
 import (
 	"context"
 	"io/fs"
-	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/northbright/iocopy"
-	"github.com/northbright/pathelper"
 )
 
 // FSDirInfo returns the dir info.
 func FSDirInfo(fsys fs.FS, dir string, exts []string) (*DirInfoData, error) {
-	di := &DirInfoData{}
+	return dirInfo(context.Background(), fsSource{fsys}, dir, "", &Options{Exts: exts})
+}
 
-	for _, ext := range exts {
-		di.Exts = append(di.Exts, strings.ToLower(ext))
-	}
+// FSDirInfoWithOptions returns the dir info with the same options passed to [CopyFSDirWithOptions].
+// Options.Compare is not applied without dst. Use [FSDirInfoWithDst] to get the totals of a copy to dst.
+func FSDirInfoWithOptions(fsys fs.FS, dir string, opts *Options) (*DirInfoData, error) {
+	return dirInfo(context.Background(), fsSource{fsys}, dir, "", opts)
+}
 
-	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
-		// Check err first.
-		// d is nil while the err is "no such file or directory".
-		if err != nil {
-			return err
-		}
+// FSDirInfoWithDst returns the dir info of the copy from dir of the file system to dst with the same options passed to [CopyFSDirWithOptions].
+// The unchanged files skipped by Options.Compare are not counted.
+func FSDirInfoWithDst(fsys fs.FS, dir, dst string, opts *Options) (*DirInfoData, error) {
+	return dirInfo(context.Background(), fsSource{fsys}, dir, dst, opts)
+}
 
-		// d is a dir.
-		if d.IsDir() {
-			di.SubDirCount += 1
-			return nil
-		}
+// FSDirInfoWithFilter returns the dir info of the files selected by the filter.
+func FSDirInfoWithFilter(fsys fs.FS, dir string, filter *Filter) (*DirInfoData, error) {
+	return dirInfo(context.Background(), fsSource{fsys}, dir, "", &Options{Filter: filter})
+}
 
-		// d is a file.
-		fi, err := d.Info()
-		if err != nil {
-			return err
-		}
+// CopyFSDirWithOptions copies files and sub-directories of src from the file system to dst recursively with options and returns the number of bytes copied.
+// It accepts [context.Context] to make copy cancalable.
+// ctx: context to stop the copy.
+// fsys: file system.
+// src: source dir.
+// dst: destination dir.
+// opts: options of the copy. Leave it nil to use the default options.
+func CopyFSDirWithOptions(ctx context.Context, fsys fs.FS, src, dst string, opts *Options) (n int64, err error) {
+	return copyDir(ctx, fsSource{fsys}, src, dst, opts, nil)
+}
 
-		if len(di.Exts) > 0 {
-			for _, ext := range di.Exts {
-				if strings.ToLower(filepath.Ext(d.Name())) == ext {
-					di.FileCount += 1
-					di.TotalSize += fi.Size()
-					return nil
-				}
-			}
-			return nil
-		} else {
-			di.FileCount += 1
-			di.TotalSize += fi.Size()
-			return nil
-		}
-	})
+// CopyFSDirWithFilter copies the files selected by the filter and sub-directories of src from the file system to dst recursively and returns the number of bytes copied.
+// It accepts [context.Context] to make copy cancalable.
+// ctx: context to stop the copy.
+// fsys: file system.
+// src: source dir.
+// dst: destination dir.
+// filter: filter to select the files. Leave it nil for all files.
+func CopyFSDirWithFilter(ctx context.Context, fsys fs.FS, src, dst string, filter *Filter) (n int64, err error) {
+	return copyDir(ctx, fsSource{fsys}, src, dst, &Options{Filter: filter}, nil)
+}
 
-	return di, err
+// ResumeCopyFSDir resumes the copy of [CopyFSDirWithOptions] from the checkpoint file specified by opts.Checkpoint.
+// See [ResumeCopyDir] for more information.
+func ResumeCopyFSDir(ctx context.Context, fsys fs.FS, src, dst string, opts *Options) (n int64, err error) {
+	return resumeCopyDir(ctx, fsSource{fsys}, src, dst, opts)
 }
 
 // CopyFSDirBufferWithProgress copies files and sub-directories of src from the file system to dst recursively and returns the number of bytes copied.
@@ -74,84 +74,7 @@ func CopyFSDirBufferWithProgress(
 	exts []string,
 	buf []byte,
 	fn iocopy.OnWrittenFunc) (n int64, err error) {
-	di, err := FSDirInfo(fsys, src, exts)
-	if err != nil {
-		return 0, err
-	}
-
-	totalSize := di.TotalSize
-	copied := int64(0)
-
-	err = fs.WalkDir(fsys, src, func(path string, d fs.DirEntry, err error) error {
-		// Check err first.
-		// d is nil while the err is "no such file or directory".
-		if err != nil {
-			return err
-		}
-
-		// d is a dir.
-		if d.IsDir() {
-			// Create the dir even if the source dir is empty.
-			dstDir := pathelper.ReplacePrefix(path, src, dst)
-			return pathelper.CreateDirIfNotExists(dstDir, 0755)
-		}
-
-		// d is a file.
-		// Check if file ext matches desired exts.
-		matched := false
-		if len(di.Exts) > 0 {
-			for _, ext := range di.Exts {
-				if strings.ToLower(filepath.Ext(d.Name())) == ext {
-					matched = true
-					break
-				}
-			}
-		} else {
-			matched = true
-		}
-
-		// Skip if ext is not matched.
-		if !matched {
-			return nil
-		}
-
-		fSrc, err := fsys.Open(path)
-		if err != nil {
-			return err
-		}
-		defer fSrc.Close()
-
-		// Make dst file name.
-		dstFile := pathelper.ReplacePrefix(path, src, dst)
-		fDst, err := os.Create(dstFile)
-		if err != nil {
-			return err
-		}
-		defer fDst.Close()
-
-		n, err := iocopy.CopyBufferWithProgress(
-			// Context.
-			ctx,
-			// Dst.
-			fDst,
-			// Src.
-			fSrc,
-			// Buffer.
-			buf,
-			// Total size of all files in the dir.
-			totalSize,
-			// Bytes of copied files.
-			copied,
-			// Callback to report progress.
-			fn,
-		)
-		if err != nil {
-			return err
-		}
-		copied += n
-		return nil
-	})
-	return copied, err
+	return copyDir(ctx, fsSource{fsys}, src, dst, &Options{Exts: exts, Buf: buf, OnWritten: fn}, nil)
 }
 
 // CopyFSDir copies files and sub-directories of src from the file system to dst recursively and returns the number of bytes copied.
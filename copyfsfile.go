@@ -3,12 +3,10 @@ package cp
 import (
 	"context"
 	"errors"
+	"hash"
 	"io/fs"
-	"os"
-	"path/filepath"
 
 	"github.com/northbright/iocopy"
-	"github.com/northbright/pathelper"
 )
 
 var (
@@ -16,9 +14,46 @@ var (
 	ErrNotFSRegularFile = errors.New("not a regular file in file system")
 )
 
+// CopyFSFileWithOptions copies file from src in the file system to dst with options and returns the number of bytes copied.
+// It accepts [context.Context] to make copy cancalable.
+// copied: number of bytes copied previously.
+// It can be used to resume the copy.
+// 1. Set copied to 0 when call CopyFSFileWithOptions for the first time.
+// 2. User stops the copy and CopyFSFileWithOptions returns the number of bytes copied and error.
+// 3. Check if err == context.Canceled || err == context.DeadlineExceeded.
+// 4. Set copied to the "n" return value of previous CopyFSFileWithOptions when make next call to resume the copy.
+// If the opened file implements [io.Seeker], it seeks to copied.
+// Otherwise, it reads and discards the first copied bytes.
+// opts: options of the copy. Leave it nil to use the default options.
+func CopyFSFileWithOptions(ctx context.Context, fsys fs.FS, src, dst string, copied int64, opts *Options) (n int64, err error) {
+	n, _, err = copyFile(ctx, fsSource{fsys}, src, dst, copied, opts, nil, nil)
+	return n, err
+}
+
+// ResumeCopyFSFile resumes the copy of [CopyFSFileWithOptions] in chunks from the checkpoint file specified by opts.Checkpoint.
+// See [ResumeCopyFile] for more information.
+func ResumeCopyFSFile(ctx context.Context, fsys fs.FS, src, dst string, opts *Options) (n int64, err error) {
+	return resumeCopyFile(ctx, fsSource{fsys}, src, dst, opts)
+}
+
+// CopyFSFileWithHashes copies file from src in the file system to dst with options and returns the number of bytes copied and the checksums.
+// See [CopyFileWithHashes] for more information.
+func CopyFSFileWithHashes(
+	ctx context.Context,
+	fsys fs.FS,
+	src string,
+	dst string,
+	copied int64,
+	hashes []hash.Hash,
+	opts *Options) (n int64, sums [][]byte, err error) {
+	return copyFile(ctx, fsSource{fsys}, src, dst, copied, opts, hashes, nil)
+}
+
 // CopyFSFileBufferWithProgress copies file from src to dst and returns the number of bytes copied.
 // It accepts [context.Context] to make copy cancalable.
 // It also accepts callback function on bytes written to report progress.
+// Symlinks in the file system are followed like [fs.FS.Open] does.
+// Use [CopyFSFileWithOptions] to resume the copy.
 // fn: callback on bytes written.
 func CopyFSFileBufferWithProgress(
 	ctx context.Context,
@@ -27,41 +62,8 @@ func CopyFSFileBufferWithProgress(
 	dst string,
 	buf []byte,
 	fn iocopy.OnWrittenFunc) (n int64, err error) {
-	// Open the src file.
-	fSrc, err := fsys.Open(src)
-	if err != nil {
-		return 0, err
-	}
-	defer fSrc.Close()
-
-	// Get the size of src file.
-	fi, err := fSrc.Stat()
-	if err != nil {
-		return 0, err
-	}
-
-	// Check if src's a regular file.
-	if !fi.Mode().IsRegular() {
-		return 0, ErrNotFSRegularFile
-	}
-
-	// Get total size of src.
-	size := fi.Size()
-
-	// Make dest file's dir if it does not exist.
-	dir := filepath.Dir(dst)
-	if err := pathelper.CreateDirIfNotExists(dir, 0755); err != nil {
-		return 0, err
-	}
-
-	// Create the dst file.
-	fDst, err := os.Create(dst)
-	if err != nil {
-		return 0, err
-	}
-	defer fDst.Close()
-
-	return iocopy.CopyBufferWithProgress(ctx, fDst, fSrc, buf, size, 0, fn)
+	n, _, err = copyFile(ctx, fsSource{fsys}, src, dst, 0, &Options{Buf: buf, OnWritten: fn, Symlinks: SymlinkFollow}, nil, nil)
+	return n, err
 }
 
 // CopyFSFile copies file from src to dst and returns the number of bytes copied.
@@ -0,0 +1,28 @@
+package cp
+
+import (
+	"errors"
+)
+
+var (
+	// ErrFastPathUnavailable represents the error that no kernel fast path is available while FastPathForce is set.
+	ErrFastPathUnavailable = errors.New("kernel fast path unavailable")
+)
+
+// FastPathMode specifies whether to use kernel fast paths(reflink and copy_file_range) to copy files.
+// Fast paths are only available on Linux for files of the local file system.
+type FastPathMode int
+
+const (
+	// FastPathAuto tries FICLONE(reflink), then copy_file_range,
+	// and falls back to copy through the user-space buffer.
+	FastPathAuto FastPathMode = iota
+	// FastPathForce tries the same fast paths as FastPathAuto,
+	// but returns ErrFastPathUnavailable instead of falling back.
+	FastPathForce
+	// FastPathNever always copies through the user-space buffer.
+	FastPathNever
+)
+
+// fastPathChunkSize is the number of bytes to copy by copy_file_range between checks of the context.
+const fastPathChunkSize = 8 * 1024 * 1024
@@ -0,0 +1,92 @@
+package cp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/northbright/iocopy"
+	"golang.org/x/sys/unix"
+)
+
+// copyFast copies src to dst from offset by FICLONE and copy_file_range.
+// FICLONE is only tried when offset is 0.
+// It honors ctx between chunks and reports progress after each chunk.
+// It returns errors.ErrUnsupported if no fast path is available before any byte is copied.
+// offset: offset of src and dst to resume the copy.
+// size: size of src.
+// rangeCopy: whether to try copy_file_range after FICLONE.
+func copyFast(
+	ctx context.Context,
+	dst *os.File,
+	src io.Reader,
+	offset int64,
+	size int64,
+	total int64,
+	prev int64,
+	fn iocopy.OnWrittenFunc,
+	rangeCopy bool) (n int64, err error) {
+	f, ok := src.(*os.File)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// Try to clone the whole file.
+	if offset == 0 {
+		if err = unix.IoctlFileClone(int(dst.Fd()), int(f.Fd())); err == nil {
+			reportProgress(fn, total, prev, size)
+			return size, nil
+		}
+
+		if !fastPathUnsupported(err) {
+			return 0, &fs.PathError{Op: "ficlone", Path: dst.Name(), Err: err}
+		}
+	}
+
+	if !rangeCopy {
+		return 0, errors.ErrUnsupported
+	}
+
+	roff, woff := offset, offset
+	for roff < size {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+
+		m, err := unix.CopyFileRange(int(f.Fd()), &roff, int(dst.Fd()), &woff, int(min(size-roff, fastPathChunkSize)), 0)
+		if err != nil {
+			if n == 0 && fastPathUnsupported(err) {
+				return 0, errors.ErrUnsupported
+			}
+			return n, &fs.PathError{Op: "copy_file_range", Path: dst.Name(), Err: err}
+		}
+
+		// src is truncated while copying.
+		if m == 0 {
+			break
+		}
+
+		n += int64(m)
+		reportProgress(fn, total, prev, n)
+	}
+
+	return n, nil
+}
+
+// fastPathUnsupported reports whether the error means the fast path is not supported for the files.
+func fastPathUnsupported(err error) bool {
+	return errors.Is(err, unix.EOPNOTSUPP) ||
+		errors.Is(err, unix.ENOTSUP) ||
+		errors.Is(err, unix.EXDEV) ||
+		errors.Is(err, unix.EINVAL) ||
+		errors.Is(err, unix.ENOSYS) ||
+		errors.Is(err, unix.ENOTTY) ||
+		errors.Is(err, unix.EBADF) ||
+		errors.Is(err, unix.EPERM)
+}
@@ -0,0 +1,202 @@
+package cp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// newFastPathFiles creates src with the content larger than 2 chunks of copy_file_range and an empty dst.
+func newFastPathFiles(t *testing.T) (src, dst *os.File, content []byte) {
+	t.Helper()
+
+	content = make([]byte, 2*fastPathChunkSize+12345)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "src"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := os.Open(filepath.Join(dir, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { src.Close() })
+
+	dst, err = os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dst.Close() })
+
+	return src, dst, content
+}
+
+// checkContent checks the content of the file f.
+func checkContent(t *testing.T, f *os.File, content []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("content of %v differs: got %v bytes, want %v bytes", f.Name(), len(data), len(content))
+	}
+}
+
+func TestCopyFast(t *testing.T) {
+	src, dst, content := newFastPathFiles(t)
+	size := int64(len(content))
+
+	// Progress reported after FICLONE or each chunk of copy_file_range.
+	var written []int64
+	fn := func(total, prev, current int64, percent float32) {
+		written = append(written, prev+current)
+	}
+
+	n, err := copyFast(context.Background(), dst, src, 0, size, size, 0, fn, true)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("no fast path is available on the file system")
+	}
+	if err != nil {
+		t.Fatalf("copyFast() error: %v", err)
+	}
+	if n != size {
+		t.Errorf("copyFast() = %v, want %v", n, size)
+	}
+	checkContent(t, dst, content)
+
+	if len(written) == 0 || written[len(written)-1] != size {
+		t.Fatalf("progress = %v, want the final progress %v", written, size)
+	}
+
+	// FICLONE reports the whole file at once.
+	if len(written) > 1 {
+		for i, w := range written[:len(written)-1] {
+			if want := int64(i+1) * fastPathChunkSize; w != want {
+				t.Errorf("progress[%v] = %v, want %v", i, w, want)
+			}
+		}
+	}
+}
+
+func TestCopyFastRangeFromOffset(t *testing.T) {
+	src, dst, content := newFastPathFiles(t)
+	size := int64(len(content))
+
+	// FICLONE is not tried while resuming, so the fast path falls back to copy_file_range.
+	offset := int64(fastPathChunkSize / 2)
+	if _, err := dst.Write(content[:offset]); err != nil {
+		t.Fatal(err)
+	}
+
+	var written []int64
+	fn := func(total, prev, current int64, percent float32) {
+		written = append(written, prev+current)
+	}
+
+	n, err := copyFast(context.Background(), dst, src, offset, size, size, offset, fn, true)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("copy_file_range is not available on the file system")
+	}
+	if err != nil {
+		t.Fatalf("copyFast() error: %v", err)
+	}
+	if n != size-offset {
+		t.Errorf("copyFast() = %v, want %v", n, size-offset)
+	}
+	checkContent(t, dst, content)
+
+	var want []int64
+	for w := offset + fastPathChunkSize; w < size; w += fastPathChunkSize {
+		want = append(want, w)
+	}
+	want = append(want, size)
+	if len(written) != len(want) {
+		t.Fatalf("progress = %v, want %v", written, want)
+	}
+	for i := range want {
+		if written[i] != want[i] {
+			t.Errorf("progress[%v] = %v, want %v", i, written[i], want[i])
+		}
+	}
+}
+
+func TestCopyFastCancel(t *testing.T) {
+	src, dst, content := newFastPathFiles(t)
+	size := int64(len(content))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop the copy after the first chunk.
+	fn := func(total, prev, current int64, percent float32) {
+		cancel()
+	}
+
+	// Start from an offset to copy by copy_file_range in chunks.
+	n, err := copyFast(ctx, dst, src, 1, size, size, 1, fn, true)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("copy_file_range is not available on the file system")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("copyFast() error = %v, want context.Canceled", err)
+	}
+	if n != fastPathChunkSize {
+		t.Errorf("copyFast() = %v, want %v", n, fastPathChunkSize)
+	}
+}
+
+func TestCopyFastUnsupported(t *testing.T) {
+	content := []byte("hello, world!")
+	fsys := fstest.MapFS{"a.txt": &fstest.MapFile{Data: content, Mode: 0644}}
+	dst := filepath.Join(t.TempDir(), "a.txt")
+
+	// Files of fstest.MapFS are not *os.File, so no fast path is available.
+	_, err := CopyFSFileWithOptions(context.Background(), fsys, "a.txt", dst, 0, &Options{FastPath: FastPathForce})
+	if !errors.Is(err, ErrFastPathUnavailable) {
+		t.Fatalf("CopyFSFileWithOptions() error = %v, want ErrFastPathUnavailable", err)
+	}
+
+	// FastPathAuto falls back to copy through the buffer.
+	n, err := CopyFSFileWithOptions(context.Background(), fsys, "a.txt", dst, 0, nil)
+	if err != nil {
+		t.Fatalf("CopyFSFileWithOptions() error: %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || n != int64(len(content)) || !bytes.Equal(data, content) {
+		t.Errorf("CopyFSFileWithOptions() = %v, dst = %q, %v, want %v, %q", n, data, err, len(content), content)
+	}
+}
+
+func TestCopyFileFastPathForce(t *testing.T) {
+	src, dst, content := newFastPathFiles(t)
+	src.Close()
+	dst.Close()
+
+	var last int64
+	opts := &Options{
+		FastPath: FastPathForce,
+		OnWritten: func(total, prev, current int64, percent float32) {
+			last = prev + current
+		},
+	}
+
+	n, err := CopyFileWithOptions(context.Background(), src.Name(), dst.Name(), 0, opts)
+	if errors.Is(err, ErrFastPathUnavailable) {
+		t.Skip("no fast path is available on the file system")
+	}
+	if err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	if n != int64(len(content)) || last != n {
+		t.Errorf("CopyFileWithOptions() = %v, last progress %v, want %v", n, last, len(content))
+	}
+	checkContent(t, dst, content)
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package cp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/northbright/iocopy"
+)
+
+// copyFast copies src to dst by kernel fast paths.
+// Fast paths are not supported on this platform and it always returns errors.ErrUnsupported.
+func copyFast(
+	ctx context.Context,
+	dst *os.File,
+	src io.Reader,
+	offset int64,
+	size int64,
+	total int64,
+	prev int64,
+	fn iocopy.OnWrittenFunc,
+	rangeCopy bool) (n int64, err error) {
+	return 0, errors.ErrUnsupported
+}
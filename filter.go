@@ -0,0 +1,305 @@
+package cp
+
+import (
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filter selects the files of dir copies by extension, size, modification time, hidden status and a custom predicate.
+// DirInfo and the copy functions apply the same filter to keep the totals consistent.
+// The zero value selects all files.
+type Filter struct {
+	// Desired file extensions, e.g. ".md". Leave it nil or empty for all files.
+	Exts []string
+	// Minimum size of the regular files in bytes.
+	MinSize int64
+	// Maximum size of the regular files in bytes. Leave it 0 for no limit.
+	MaxSize int64
+	// Select the files modified at or after the time, e.g. time.Now().AddDate(0, 0, -7) for the last 7 days.
+	// Leave it zero for no limit.
+	ModifiedAfter time.Time
+	// Select the files modified before the time. Leave it zero for no limit.
+	ModifiedBefore time.Time
+	// Skip hidden files and dirs with their contents.
+	// The names starting with "." are hidden, and so are the files with the hidden attribute on Windows.
+	SkipHidden bool
+	// MIME types or categories to select the files by content regardless of the names,
+	// e.g. "image/jpeg", "image" or "image/*" for all images.
+	// The MIME type is detected by sniffing the first 512 bytes with [net/http.DetectContentType]
+	// and the magic numbers of common archive and media types.
+	// Only the regular files are selected if it's set. Leave it nil or empty for all files.
+	MIMETypes []string
+	// Custom predicate called for each file and dir except the source dir.
+	// Returning false skips the file, or the dir with its contents.
+	// path: slash-separated path relative to the source dir.
+	Match func(path string, d fs.DirEntry) bool
+}
+
+// matchDir reports whether the dir should be walked.
+// rel: slash-separated path of the dir relative to the source dir.
+func (ft *Filter) matchDir(rel string, fi fs.FileInfo) bool {
+	if ft.SkipHidden && isHidden(fi) {
+		return false
+	}
+	return ft.Match == nil || ft.Match(rel, fs.FileInfoToDirEntry(fi))
+}
+
+// matchFile reports whether the file(including symlinks and special files) should be copied.
+// The size limits only apply to the regular files.
+// rel: slash-separated path of the file relative to the source dir.
+func (ft *Filter) matchFile(rel string, fi fs.FileInfo) bool {
+	if !matchExts(fi.Name(), ft.Exts) {
+		return false
+	}
+
+	if fi.Mode().IsRegular() {
+		if fi.Size() < ft.MinSize || (ft.MaxSize > 0 && fi.Size() > ft.MaxSize) {
+			return false
+		}
+	} else if len(ft.MIMETypes) > 0 {
+		return false
+	}
+
+	if !ft.ModifiedAfter.IsZero() && fi.ModTime().Before(ft.ModifiedAfter) {
+		return false
+	}
+	if !ft.ModifiedBefore.IsZero() && !fi.ModTime().Before(ft.ModifiedBefore) {
+		return false
+	}
+
+	if ft.SkipHidden && isHidden(fi) {
+		return false
+	}
+	return ft.Match == nil || ft.Match(rel, fs.FileInfoToDirEntry(fi))
+}
+
+// isHidden reports whether the file or dir is hidden.
+func isHidden(fi fs.FileInfo) bool {
+	return strings.HasPrefix(fi.Name(), ".") || hasHiddenAttr(fi)
+}
+
+// Rule is an include or exclude rule matched against the slash-separated path relative to the source dir.
+// Set either Glob or Regexp.
+type Rule struct {
+	// Glob pattern in [path.Match] syntax, where "**" matches zero or more path segments, e.g. "src/**/*.go".
+	// A pattern without "/" matches the base name at any depth, e.g. "node_modules" or "*.tar.gz".
+	// A pattern with "/" matches the whole relative path, and a leading "/" is ignored.
+	// A pattern ending with "/" only matches dirs, e.g. "build/".
+	Glob string
+	// Regular expression matched against the relative path. It's not anchored unless "^" and "$" are used.
+	Regexp *regexp.Regexp
+}
+
+// match reports whether the rule matches the relative path.
+func (r Rule) match(rel string, isDir bool) bool {
+	if r.Regexp != nil {
+		return r.Regexp.MatchString(rel)
+	}
+
+	pattern := r.Glob
+	if pattern == "" {
+		return false
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchGlob(strings.TrimPrefix(pattern, "/"), rel)
+}
+
+// matchGlob reports whether the slash-separated name matches the glob pattern which supports "**".
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments matches the path segments against the pattern segments.
+func matchSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for len(patterns) > 0 && patterns[0] == "**" {
+				patterns = patterns[1:]
+			}
+			if len(patterns) == 0 {
+				return true
+			}
+
+			for i := range names {
+				if matchSegments(patterns, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(patterns[0], names[0]); !ok {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// matchRules reports whether any of the rules matches the relative path.
+func matchRules(rules []Rule, rel string, isDir bool) bool {
+	for _, r := range rules {
+		if r.match(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileFilter selects the files and dirs of dir copies.
+// It's shared by DirInfo, the copy functions and the manifest functions to keep the totals consistent.
+type fileFilter struct {
+	// Lower-cased file extensions of Options.Exts.
+	exts []string
+	// Copy of Options.Filter with lower-cased file extensions.
+	filter  Filter
+	include []Rule
+	exclude []Rule
+	// Source to read the ignore files.
+	s source
+	// Name of the ignore files. It's empty if the ignore files are disabled.
+	ignoreFile string
+	// Patterns of the ignore files for each dir walked, including the ones of the ancestors.
+	ignores map[string][]ignorePattern
+	// Paths of the entries to copy while executing a plan. It's nil to select all entries.
+	planned map[string]bool
+}
+
+// newFileFilter returns the filter of the options for the source.
+func newFileFilter(s source, opts *Options) *fileFilter {
+	var filter Filter
+	if opts.Filter != nil {
+		filter = *opts.Filter
+		filter.Exts = lowerExts(filter.Exts)
+	}
+
+	return &fileFilter{
+		exts:       lowerExts(opts.Exts),
+		filter:     filter,
+		include:    opts.Include,
+		exclude:    opts.Exclude,
+		s:          s,
+		ignoreFile: opts.IgnoreFile,
+		ignores:    map[string][]ignorePattern{},
+		planned:    opts.planned,
+	}
+}
+
+// walkDir reports whether the dir should be skipped with its contents.
+// It loads the ignore file in the dir if it's not skipped.
+// It should be called for each dir in the walk order before the entries of the dir are matched.
+// p: path of the dir in the source.
+// rel: slash-separated path of the dir relative to the source dir. The source dir itself is never skipped.
+// fi: file info of the dir.
+func (f *fileFilter) walkDir(p, rel string, fi fs.FileInfo) (skip bool, err error) {
+	if rel != "." && (!f.inPlan(rel) || matchRules(f.exclude, rel, true) || f.ignored(rel, true) || !f.filter.matchDir(rel, fi)) {
+		return true, nil
+	}
+
+	return false, f.loadIgnores(p, rel)
+}
+
+// loadIgnores loads the patterns of the ignore file in the dir after the ones of its ancestors.
+// It should be called for each dir after its parent.
+// p: path of the dir in the source. Leave it empty if the dir does not exist in the source.
+// rel: slash-separated path of the dir relative to the source dir.
+func (f *fileFilter) loadIgnores(p, rel string) error {
+	if f.ignoreFile == "" {
+		return nil
+	}
+
+	var patterns []ignorePattern
+	if p != "" {
+		var err error
+		if patterns, err = loadIgnoreFile(f.s, p, rel, f.ignoreFile); err != nil {
+			return err
+		}
+	}
+
+	// Clip the patterns of the parent to avoid sharing the array with the siblings.
+	var parent []ignorePattern
+	if rel != "." {
+		parent = slices.Clip(f.ignores[path.Dir(rel)])
+	}
+	f.ignores[rel] = append(parent, patterns...)
+	return nil
+}
+
+// excluded reports whether the file or dir is excluded by the rules matched against the path and name:
+// Exclude, the ignore files and Filter.SkipHidden.
+// The ignore files of the ancestors should be loaded by loadIgnores.
+// rel: slash-separated path relative to the source dir.
+func (f *fileFilter) excluded(rel string, fi fs.FileInfo) bool {
+	return matchRules(f.exclude, rel, fi.IsDir()) || f.ignored(rel, fi.IsDir()) || (f.filter.SkipHidden && isHidden(fi))
+}
+
+// inPlan reports whether the path is in the plan being executed.
+func (f *fileFilter) inPlan(rel string) bool {
+	return f.planned == nil || f.planned[rel]
+}
+
+// ignored reports whether the path is ignored by the ignore files of its ancestors.
+func (f *fileFilter) ignored(rel string, isDir bool) bool {
+	if f.ignoreFile == "" {
+		return false
+	}
+	return ignored(f.ignores[path.Dir(rel)], rel, isDir)
+}
+
+// matchFile reports whether the file(including symlinks and special files) should be copied.
+// The content of the file is sniffed after the other rules are matched if Filter.MIMETypes is set.
+// p: path of the file in the source.
+// rel: slash-separated path of the file relative to the source dir.
+// fi: file info of the file.
+func (f *fileFilter) matchFile(p, rel string, fi fs.FileInfo) (bool, error) {
+	if !f.inPlan(rel) || !matchExts(path.Base(rel), f.exts) || !f.filter.matchFile(rel, fi) {
+		return false, nil
+	}
+
+	if len(f.include) > 0 && !matchRules(f.include, rel, false) {
+		return false, nil
+	}
+
+	if matchRules(f.exclude, rel, false) || f.ignored(rel, false) {
+		return false, nil
+	}
+
+	if len(f.filter.MIMETypes) == 0 {
+		return true, nil
+	}
+	return f.matchMIMETypes(p)
+}
+
+// matchMIMETypes reports whether the MIME type of the file in the source matches Filter.MIMETypes.
+func (f *fileFilter) matchMIMETypes(p string) (bool, error) {
+	r, err := f.s.open(p)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	t, err := readMIMEType(r)
+	if err != nil {
+		return false, err
+	}
+	return matchMIMETypes(t, f.filter.MIMETypes), nil
+}
@@ -0,0 +1,203 @@
+package cp
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleMatch(t *testing.T) {
+	for _, tc := range []struct {
+		rule  Rule
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		// A pattern without "/" matches the base name at any depth.
+		{Rule{Glob: "*.tar.gz"}, "a.tar.gz", false, true},
+		{Rule{Glob: "*.tar.gz"}, "x/y/a.tar.gz", false, true},
+		{Rule{Glob: "*.tar.gz"}, "a.gz", false, false},
+		{Rule{Glob: "node_modules"}, "x/node_modules", true, true},
+		// "**" at the start.
+		{Rule{Glob: "**/*.go"}, "a.go", false, true},
+		{Rule{Glob: "**/*.go"}, "x/y/a.go", false, true},
+		{Rule{Glob: "**/*.go"}, "x/y/a.txt", false, false},
+		// "**" in the middle.
+		{Rule{Glob: "src/**/*.go"}, "src/a.go", false, true},
+		{Rule{Glob: "src/**/*.go"}, "src/x/y/a.go", false, true},
+		{Rule{Glob: "src/**/*.go"}, "lib/src/a.go", false, false},
+		{Rule{Glob: "a/**/b/**/c"}, "a/x/b/y/z/c", false, true},
+		{Rule{Glob: "a/**/b/**/c"}, "a/x/y/c", false, false},
+		// "**" at the end.
+		{Rule{Glob: "docs/**"}, "docs", true, true},
+		{Rule{Glob: "docs/**"}, "docs/x/a.md", false, true},
+		{Rule{Glob: "docs/**"}, "x/docs/a.md", false, false},
+		// A pattern with "/" matches the whole path, and a leading "/" is ignored.
+		{Rule{Glob: "/x/*.txt"}, "x/a.txt", false, true},
+		{Rule{Glob: "x/*.txt"}, "x/y/a.txt", false, false},
+		// Dir-only patterns.
+		{Rule{Glob: "build/"}, "build", true, true},
+		{Rule{Glob: "build/"}, "x/build", true, true},
+		{Rule{Glob: "build/"}, "build", false, false},
+		{Rule{Glob: "out/build/"}, "out/build", true, true},
+		// Regexp rules are not anchored unless "^" and "$" are used.
+		{Rule{Regexp: regexp.MustCompile(`\.bak$`)}, "x/a.bak", false, true},
+		{Rule{Regexp: regexp.MustCompile(`tmp`)}, "x/tmpdir/a.txt", false, true},
+		{Rule{Regexp: regexp.MustCompile(`^tmp$`)}, "x/tmp", true, false},
+		// An empty rule matches nothing.
+		{Rule{}, "a.txt", false, false},
+	} {
+		if got := tc.rule.match(tc.rel, tc.isDir); got != tc.want {
+			t.Errorf("%+v.match(%q, %v) = %v, want %v", tc.rule, tc.rel, tc.isDir, got, tc.want)
+		}
+	}
+}
+
+func TestExcludedDirsArePruned(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	for _, name := range []string{"a.go", "build/out.go", "build/sub/x.go", "src/b.go", "src/b_test.go", "src/vendor/c.go"} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Paths passed to the custom predicate.
+	var matched []string
+	opts := &Options{
+		Include: []Rule{{Glob: "**/*.go"}},
+		Exclude: []Rule{{Glob: "build/"}, {Regexp: regexp.MustCompile(`_test\.go$`)}, {Glob: "src/vendor"}},
+		Filter: &Filter{Match: func(path string, d fs.DirEntry) bool {
+			matched = append(matched, path)
+			return true
+		}},
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	if _, err := CopyDirWithOptions(context.Background(), src, dst, opts); err != nil {
+		t.Fatalf("CopyDirWithOptions() error: %v", err)
+	}
+
+	// The excluded dirs are skipped without walking their contents.
+	if !slices.Contains(matched, "src/b.go") {
+		t.Errorf("src/b.go is not matched: %q", matched)
+	}
+	for _, p := range matched {
+		if strings.HasPrefix(p, "build") || strings.HasPrefix(p, "src/vendor") {
+			t.Errorf("%v in the excluded dir is walked", p)
+		}
+	}
+
+	for _, name := range []string{"a.go", "src/b.go"} {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name))); err != nil {
+			t.Errorf("Stat(dst/%v) error: %v", name, err)
+		}
+	}
+	for _, name := range []string{"build", "src/b_test.go", "src/vendor"} {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name))); err == nil {
+			t.Errorf("dst/%v is copied", name)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	now := time.Now().Truncate(time.Second)
+
+	// Sizes and ages of the files.
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"empty.txt", 0, time.Hour},
+		{"small.txt", 10, 2 * time.Hour},
+		{"medium.txt", 100, 24 * time.Hour},
+		{"large.txt", 1000, 48 * time.Hour},
+		{".hidden.txt", 10, time.Hour},
+		{".cache/a.txt", 10, time.Hour},
+		{"sub/b.md", 100, time.Hour},
+	}
+	for _, f := range files {
+		p := filepath.Join(src, filepath.FromSlash(f.name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, bytes.Repeat([]byte("x"), f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, now.Add(-f.age), now.Add(-f.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter *Filter
+		want   []string
+	}{
+		{"nil", nil, []string{".cache/a.txt", ".hidden.txt", "empty.txt", "large.txt", "medium.txt", "small.txt", "sub/b.md"}},
+		{"min size", &Filter{MinSize: 100}, []string{"large.txt", "medium.txt", "sub/b.md"}},
+		{"max size", &Filter{MaxSize: 10}, []string{".cache/a.txt", ".hidden.txt", "empty.txt", "small.txt"}},
+		{"size range", &Filter{MinSize: 1, MaxSize: 100, Exts: []string{".TXT"}}, []string{".cache/a.txt", ".hidden.txt", "medium.txt", "small.txt"}},
+		{"modified after", &Filter{ModifiedAfter: now.Add(-2 * time.Hour)}, []string{".cache/a.txt", ".hidden.txt", "empty.txt", "small.txt", "sub/b.md"}},
+		{"modified before", &Filter{ModifiedBefore: now.Add(-2 * time.Hour)}, []string{"large.txt", "medium.txt"}},
+		{"skip hidden", &Filter{SkipHidden: true}, []string{"empty.txt", "large.txt", "medium.txt", "small.txt", "sub/b.md"}},
+		{"match", &Filter{Match: func(path string, d fs.DirEntry) bool {
+			return d.IsDir() || strings.HasPrefix(path, "sub/") || d.Name() == "small.txt"
+		}}, []string{"small.txt", "sub/b.md"}},
+		{"match dir", &Filter{Match: func(path string, d fs.DirEntry) bool {
+			return path != "sub"
+		}}, []string{".cache/a.txt", ".hidden.txt", "empty.txt", "large.txt", "medium.txt", "small.txt"}},
+	} {
+		di, err := DirInfoWithFilter(src, tc.filter)
+		if err != nil {
+			t.Fatalf("%v: DirInfoWithFilter() error: %v", tc.name, err)
+		}
+
+		dst := filepath.Join(t.TempDir(), "dst")
+		n, err := CopyDirWithFilter(context.Background(), src, dst, tc.filter)
+		if err != nil {
+			t.Fatalf("%v: CopyDirWithFilter() error: %v", tc.name, err)
+		}
+
+		var got []string
+		var size int64
+		err = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(dst, p)
+			got, size = append(got, filepath.ToSlash(rel)), size+fi.Size()
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%v: copied %q, want %q", tc.name, got, tc.want)
+		}
+
+		// DirInfoWithFilter and CopyDirWithFilter select the same files.
+		if di.FileCount != int64(len(got)) || di.TotalSize != size || n != size {
+			t.Errorf("%v: DirInfoWithFilter() = FileCount %v, TotalSize %v, CopyDirWithFilter() = %v, want %v, %v, %v",
+				tc.name, di.FileCount, di.TotalSize, n, len(got), size, size)
+		}
+	}
+}
@@ -5,4 +5,5 @@ go 1.24.0
 require (
 	github.com/northbright/iocopy v1.16.2
 	github.com/northbright/pathelper v1.0.9
+	golang.org/x/sys v0.41.0
 )
@@ -0,0 +1,20 @@
+package cp
+
+import (
+	"os"
+)
+
+// fileID identifies a file by device and inode numbers.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// createHardLink creates dst as a hard link to the copied file target.
+// An existing non-dir dst is replaced.
+func createHardLink(target, dst string) error {
+	if err := removeIfNotDir(dst); err != nil {
+		return err
+	}
+	return os.Link(target, dst)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package cp
+
+import (
+	"io/fs"
+)
+
+// hardLinkID returns the file ID of the file info if it has more than one hard link.
+// Hard links are not detected on this platform.
+func hardLinkID(fi fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package cp
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// hardLinkID returns the file ID of the file info if it has more than one hard link.
+func hardLinkID(fi fs.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,171 @@
+//go:build unix
+
+package cp_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/northbright/cp"
+)
+
+// newHardLinkDir creates a dir which contains a file with 3 names and a file with 1 name.
+func newHardLinkDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "c.txt"), []byte("world!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.txt", "sub/d.txt"} {
+		if err := os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, name)); err != nil {
+			t.Skipf("link: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestDirInfoHardLinks(t *testing.T) {
+	src := newHardLinkDir(t)
+
+	di, err := cp.DirInfoWithOptions(src, &cp.Options{HardLinks: true})
+	if err != nil {
+		t.Fatalf("DirInfoWithOptions() error: %v", err)
+	}
+	if di.FileCount != 2 || di.HardLinkCount != 2 || di.TotalSize != 11 {
+		t.Errorf("DirInfoWithOptions() = FileCount %v, HardLinkCount %v, TotalSize %v, want 2, 2, 11",
+			di.FileCount, di.HardLinkCount, di.TotalSize)
+	}
+
+	// Each link is counted without HardLinks.
+	di, err = cp.DirInfoWithOptions(src, nil)
+	if err != nil {
+		t.Fatalf("DirInfoWithOptions() error: %v", err)
+	}
+	if di.FileCount != 4 || di.HardLinkCount != 0 || di.TotalSize != 21 {
+		t.Errorf("DirInfoWithOptions() = FileCount %v, HardLinkCount %v, TotalSize %v, want 4, 0, 21",
+			di.FileCount, di.HardLinkCount, di.TotalSize)
+	}
+}
+
+func TestCopyDirHardLinks(t *testing.T) {
+	src := newHardLinkDir(t)
+
+	for _, workers := range []int{0, 4} {
+		dst := filepath.Join(t.TempDir(), "dst")
+
+		var last int64
+		opts := &cp.Options{
+			HardLinks: true,
+			Workers:   workers,
+			OnWritten: func(total, prev, current int64, percent float32) {
+				if total != 11 {
+					t.Errorf("workers %v: OnWritten() total = %v, want 11", workers, total)
+				}
+				last = prev + current
+			},
+		}
+
+		n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+		if err != nil {
+			t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+		}
+		if n != 11 || last != 11 {
+			t.Errorf("workers %v: CopyDirWithOptions() = %v, last progress %v, want 11, 11", workers, n, last)
+		}
+
+		a, err := os.Stat(filepath.Join(dst, "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"b.txt", "sub/d.txt"} {
+			fi, err := os.Stat(filepath.Join(dst, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(a, fi) {
+				t.Errorf("workers %v: dst/%v is not a hard link to dst/a.txt", workers, name)
+			}
+		}
+
+		c, err := os.Stat(filepath.Join(dst, "c.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os.SameFile(a, c) {
+			t.Errorf("workers %v: dst/c.txt is a hard link to dst/a.txt", workers)
+		}
+
+		if data, err := os.ReadFile(filepath.Join(dst, "sub", "d.txt")); err != nil || string(data) != "hello" {
+			t.Errorf("workers %v: dst/sub/d.txt = %q, %v, want %q", workers, data, err, "hello")
+		}
+	}
+}
+
+func TestCopyDirHardLinksFirstNameSkipped(t *testing.T) {
+	src := newHardLinkDir(t)
+
+	for _, workers := range []int{0, 4} {
+		dst := filepath.Join(t.TempDir(), "dst")
+
+		var last, lastTotal int64
+		var final cp.Progress
+		opts := &cp.Options{
+			HardLinks: true,
+			Workers:   workers,
+			// Skip the first name of the linked file.
+			BeforeFile: func(op *cp.FileOp) error {
+				op.Skip = filepath.Base(op.Src) == "a.txt"
+				return nil
+			},
+			OnWritten: func(total, prev, current int64, percent float32) {
+				if prev+current > total {
+					t.Errorf("workers %v: OnWritten() progress %v exceeds total %v", workers, prev+current, total)
+				}
+				last, lastTotal = prev+current, total
+			},
+			OnProgress: func(p cp.Progress) {
+				final = p
+			},
+		}
+
+		n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+		if err != nil {
+			t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+		}
+
+		// The content of the linked file is copied once for b.txt.
+		if n != 11 {
+			t.Errorf("workers %v: CopyDirWithOptions() = %v, want 11", workers, n)
+		}
+		if last != lastTotal || final.Done != final.Total || final.Percent != 100 {
+			t.Errorf("workers %v: last progress %v / %v, final event %+v, want 100%%", workers, last, lastTotal, final)
+		}
+
+		if _, err = os.Lstat(filepath.Join(dst, "a.txt")); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("workers %v: Lstat(dst/a.txt) error = %v, want ErrNotExist", workers, err)
+		}
+
+		b, err := os.Stat(filepath.Join(dst, "b.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := os.Stat(filepath.Join(dst, "sub", "d.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(b, d) {
+			t.Errorf("workers %v: dst/sub/d.txt is not a hard link to dst/b.txt", workers)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package cp_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/northbright/cp"
+)
+
+// Known digests of "hello, world!".
+const (
+	helloSHA256 = "68e656b251e67e8358bef8483ab0d51c6619f3e7a1a9f0e75838d41ff368f728"
+	helloMD5    = "3adbbad1791fbae3ec908894c4963870"
+	helloCRC32  = "58988d13"
+)
+
+// checkSums checks the hex-encoded checksums.
+func checkSums(t *testing.T, name string, sums [][]byte, want ...string) {
+	t.Helper()
+
+	if len(sums) != len(want) {
+		t.Errorf("%v: %v checksums, want %v", name, len(sums), len(want))
+		return
+	}
+	for i, sum := range sums {
+		if got := hex.EncodeToString(sum); got != want[i] {
+			t.Errorf("%v: checksum %v = %v, want %v", name, i, got, want[i])
+		}
+	}
+}
+
+func TestCopyFileWithHashes(t *testing.T) {
+	content := []byte("hello, world!")
+
+	src, dst := newResumeFiles(t, content, nil)
+	n, sums, err := cp.CopyFileWithHashes(context.Background(), src, dst, 0, []hash.Hash{sha256.New(), md5.New()}, nil)
+	if err != nil || n != int64(len(content)) {
+		t.Fatalf("CopyFileWithHashes() = %v, %v, want %v, nil", n, err, len(content))
+	}
+	checkSums(t, "CopyFileWithHashes()", sums, helloSHA256, helloMD5)
+
+	fsys := fstest.MapFS{"src.txt": &fstest.MapFile{Data: content, Mode: 0644}}
+	n, sums, err = cp.CopyFSFileWithHashes(context.Background(), fsys, "src.txt", dst, 0, []hash.Hash{md5.New(), sha256.New()}, nil)
+	if err != nil || n != int64(len(content)) {
+		t.Fatalf("CopyFSFileWithHashes() = %v, %v, want %v, nil", n, err, len(content))
+	}
+	checkSums(t, "CopyFSFileWithHashes()", sums, helloMD5, helloSHA256)
+
+	if data, err := os.ReadFile(dst); err != nil || string(data) != string(content) {
+		t.Errorf("dst = %q, %v, want %q", data, err, content)
+	}
+}
+
+func TestResumeCopyFileWithHashes(t *testing.T) {
+	content := []byte("hello, world!")
+
+	// The prefix copied previously is read from src to compute the checksums of the whole file.
+	for _, check := range []cp.ResumeCheck{cp.ResumeCheckNone, cp.ResumeCheckHash} {
+		src, dst := newResumeFiles(t, content, content[:5])
+
+		opts := &cp.Options{ResumeCheck: check, Buf: make([]byte, 2)}
+		n, sums, err := cp.CopyFileWithHashes(context.Background(), src, dst, 5, []hash.Hash{sha256.New()}, opts)
+		if err != nil || n != int64(len(content))-5 {
+			t.Fatalf("%v: CopyFileWithHashes() = %v, %v, want %v, nil", check, n, err, len(content)-5)
+		}
+		checkSums(t, "CopyFileWithHashes()", sums, helloSHA256)
+
+		if data, err := os.ReadFile(dst); err != nil || string(data) != string(content) {
+			t.Errorf("%v: dst = %q, %v, want %q", check, data, err, content)
+		}
+	}
+}
+
+func TestOptionsHashes(t *testing.T) {
+	content := []byte("hello, world!")
+
+	// New hashes are created for each file.
+	hashes := func() []hash.Hash { return []hash.Hash{sha256.New(), crc32.NewIEEE()} }
+
+	src, dst := newResumeFiles(t, content, nil)
+	var sums [][]byte
+	opts := &cp.Options{
+		Hashes:    hashes,
+		AfterFile: func(r *cp.FileResult) { sums = r.Sums },
+	}
+	if _, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, opts); err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	checkSums(t, "FileResult.Sums", sums, helloSHA256, helloCRC32)
+
+	// The skipped file has no checksums.
+	sums = [][]byte{}
+	opts.Overwrite = cp.OverwriteSkip
+	if _, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, opts); err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	if sums != nil {
+		t.Errorf("FileResult.Sums of the skipped file = %x, want nil", sums)
+	}
+
+	// Each file of dir copies has its own checksums.
+	dir := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, dir, map[string]string{"a.txt": "hello, world!", "sub/b.txt": "hello, world!", "c.txt": ""})
+
+	for _, workers := range []int{0, 4} {
+		var mu sync.Mutex
+		got := map[string][][]byte{}
+		opts := &cp.Options{
+			Hashes:  func() []hash.Hash { return []hash.Hash{sha256.New()} },
+			Workers: workers,
+			AfterFile: func(r *cp.FileResult) {
+				mu.Lock()
+				got[filepath.Base(r.Src)] = r.Sums
+				mu.Unlock()
+			},
+		}
+
+		if _, err := cp.CopyDirWithOptions(context.Background(), dir, filepath.Join(t.TempDir(), "dst"), opts); err != nil {
+			t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+		}
+
+		empty := sha256.Sum256(nil)
+		checkSums(t, "a.txt", got["a.txt"], helloSHA256)
+		checkSums(t, "b.txt", got["b.txt"], helloSHA256)
+		checkSums(t, "c.txt", got["c.txt"], hex.EncodeToString(empty[:]))
+	}
+}
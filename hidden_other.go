@@ -0,0 +1,13 @@
+//go:build !windows
+
+package cp
+
+import (
+	"io/fs"
+)
+
+// hasHiddenAttr reports whether the file has the hidden attribute.
+// Only the names starting with "." are hidden on the platform.
+func hasHiddenAttr(fi fs.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,14 @@
+package cp
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// hasHiddenAttr reports whether the file has the hidden attribute.
+func hasHiddenAttr(fi fs.FileInfo) bool {
+	if d, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok {
+		return d.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package cp
+
+import (
+	"io/fs"
+)
+
+// FileOp contains the file to copy passed to the BeforeFile callback.
+type FileOp struct {
+	// Source file.
+	Src string
+	// Destination file. Change it to copy the file to another path.
+	Dst string
+	// File info of the source file. It's the info of the target if the symlink is followed.
+	Info fs.FileInfo
+	// Set it to skip the file.
+	Skip bool
+}
+
+// beforeFile calls the BeforeFile callback if it's set.
+func (opts *Options) beforeFile(op *FileOp) error {
+	if opts.BeforeFile != nil {
+		return opts.BeforeFile(op)
+	}
+	return nil
+}
+
+// afterDir calls the AfterDir callback if it's set.
+func (opts *Options) afterDir(src, dst string) error {
+	if opts.AfterDir != nil {
+		return opts.AfterDir(src, dst)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package cp
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ignorePattern is a pattern of an ignore file in gitignore syntax.
+type ignorePattern struct {
+	// Slash-separated dir of the ignore file relative to the source dir.
+	base string
+	// Glob pattern without the leading "!", "/" and the trailing "/".
+	pattern string
+	// Whether the pattern re-includes the matched paths.
+	negate bool
+	// Whether the pattern only matches dirs.
+	dirOnly bool
+	// Whether the pattern is matched against the path relative to base instead of the base name.
+	anchored bool
+}
+
+// parseIgnorePattern parses the line of an ignore file.
+// It returns false if the line is blank or a comment.
+func parseIgnorePattern(base, line string) (ignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored unless they're escaped with backslashes.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimSuffix(line, " ")
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	p := ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// A pattern with a slash at the beginning or middle is relative to the dir of the ignore file.
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	p.pattern = line
+	return p, true
+}
+
+// match reports whether the pattern matches the slash-separated path relative to the source dir.
+func (p ignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if p.base != "." {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, p.base+"/")
+	}
+
+	if !p.anchored {
+		ok, _ := path.Match(p.pattern, path.Base(rel))
+		return ok
+	}
+	return matchGlob(p.pattern, rel)
+}
+
+// ignored reports whether the path is ignored by the patterns.
+// The last matched pattern decides, so the patterns of the deeper ignore files take precedence.
+func ignored(patterns []ignorePattern, rel string, isDir bool) bool {
+	ignore := false
+	for _, p := range patterns {
+		if p.match(rel, isDir) {
+			ignore = !p.negate
+		}
+	}
+	return ignore
+}
+
+// loadIgnoreFile reads the patterns of the ignore file in the dir of the source.
+// It returns nil if the ignore file does not exist.
+// dir: path of the dir in the source.
+// rel: slash-separated path of the dir relative to the source dir.
+func loadIgnoreFile(s source, dir, rel, name string) ([]ignorePattern, error) {
+	f, err := s.open(s.join(dir, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := parseIgnorePattern(rel, scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
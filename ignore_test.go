@@ -0,0 +1,161 @@
+package cp
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIgnorePattern(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		ok   bool
+		want ignorePattern
+	}{
+		{"", false, ignorePattern{}},
+		{"# comment", false, ignorePattern{}},
+		{"   ", false, ignorePattern{}},
+		{"/", false, ignorePattern{}},
+		{"*.log", true, ignorePattern{base: "sub", pattern: "*.log"}},
+		{"*.log  ", true, ignorePattern{base: "sub", pattern: "*.log"}},
+		{"*.log\r", true, ignorePattern{base: "sub", pattern: "*.log"}},
+		{"!keep.log", true, ignorePattern{base: "sub", pattern: "keep.log", negate: true}},
+		{"\\!bang", true, ignorePattern{base: "sub", pattern: "!bang"}},
+		{"\\#hash", true, ignorePattern{base: "sub", pattern: "#hash"}},
+		{"build/", true, ignorePattern{base: "sub", pattern: "build", dirOnly: true}},
+		{"/root.txt", true, ignorePattern{base: "sub", pattern: "root.txt", anchored: true}},
+		{"doc/*.md", true, ignorePattern{base: "sub", pattern: "doc/*.md", anchored: true}},
+		{"!/out/", true, ignorePattern{base: "sub", pattern: "out", negate: true, dirOnly: true, anchored: true}},
+	} {
+		p, ok := parseIgnorePattern("sub", tc.line)
+		if ok != tc.ok || p != tc.want {
+			t.Errorf("parseIgnorePattern(%q) = %+v, %v, want %+v, %v", tc.line, p, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	// parse parses the lines of the ignore file in the dir.
+	parse := func(base string, lines ...string) []ignorePattern {
+		var patterns []ignorePattern
+		for _, line := range lines {
+			if p, ok := parseIgnorePattern(base, line); ok {
+				patterns = append(patterns, p)
+			}
+		}
+		return patterns
+	}
+
+	// The patterns of the root dir are followed by the ones of sub, like loadIgnores does.
+	patterns := append(parse(".", "*.log", "!keep.log", "build/", "/top.txt", "doc/*.md", "tmp"),
+		parse("sub", "!*.log", "keep.log", "/local")...)
+
+	for _, tc := range []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		// Unanchored patterns match the base name at any depth.
+		{"a.log", false, true},
+		{"x/y/a.log", false, true},
+		{"a.txt", false, false},
+		{"tmp", true, true},
+		{"x/tmp", false, true},
+		// Negation re-includes the path.
+		{"keep.log", false, false},
+		{"x/keep.log", false, false},
+		// Dir-only patterns.
+		{"build", true, true},
+		{"x/build", true, true},
+		{"build", false, false},
+		// Anchored patterns match the path relative to the dir of the ignore file.
+		{"top.txt", false, true},
+		{"x/top.txt", false, false},
+		{"doc/a.md", false, true},
+		{"x/doc/a.md", false, false},
+		{"doc/x/a.md", false, false},
+		// The patterns of the deeper ignore file take precedence.
+		{"sub/a.log", false, false},
+		{"sub/x/a.log", false, false},
+		{"sub/keep.log", false, true},
+		{"sub/local", false, true},
+		{"local", false, false},
+		{"x/sub/local", false, false},
+	} {
+		if got := ignored(patterns, tc.rel, tc.isDir); got != tc.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", tc.rel, tc.isDir, got, tc.want)
+		}
+	}
+}
+
+func TestIgnoreFileDirInfoMatchesCopy(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	files := map[string]string{
+		".cpignore":          "*.log\nbuild/\n!important.log\n",
+		"a.txt":              "a",
+		"a.log":              "log",
+		"important.log":      "important",
+		"build/out.bin":      "out",
+		"sub/.cpignore":      "!*.log\n/local.txt\n",
+		"sub/b.log":          "sub log",
+		"sub/local.txt":      "local",
+		"sub/deep/local.txt": "deep",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := &Options{IgnoreFile: ".cpignore"}
+	di, err := DirInfoWithOptions(src, opts)
+	if err != nil {
+		t.Fatalf("DirInfoWithOptions() error: %v", err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	n, err := CopyDirWithOptions(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatalf("CopyDirWithOptions() error: %v", err)
+	}
+
+	var count, size int64
+	err = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		count, size = count+1, size+fi.Size()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if di.FileCount != count || di.TotalSize != size || n != size {
+		t.Errorf("DirInfoWithOptions() = FileCount %v, TotalSize %v, copied %v files, %v bytes, CopyDirWithOptions() = %v",
+			di.FileCount, di.TotalSize, count, size, n)
+	}
+
+	// The ignore files are copied unless they're ignored.
+	for _, name := range []string{".cpignore", "a.txt", "important.log", "sub/.cpignore", "sub/b.log", "sub/deep/local.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name))); err != nil {
+			t.Errorf("Stat(dst/%v) error: %v", name, err)
+		}
+	}
+	for _, name := range []string{"a.log", "build", "sub/local.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name))); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(dst/%v) error = %v, want ErrNotExist", name, err)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package cp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/northbright/iocopy"
+)
+
+var (
+	// ErrInvalidManifest represents the error that the manifest file can not be parsed.
+	// It's wrapped in a [fs.PathError] which contains the path of the manifest file.
+	ErrInvalidManifest = errors.New("invalid manifest")
+)
+
+// ManifestFormat is the file format of checksum manifests.
+type ManifestFormat int
+
+const (
+	// ManifestSHA256Sum is the text format of "sha256sum".
+	// Each line contains the checksum and the path, and it can be checked by "sha256sum -c" in the dir.
+	ManifestSHA256Sum ManifestFormat = iota
+	// ManifestJSON is the JSON format which contains the size and modification time of the files.
+	ManifestJSON
+)
+
+// String implements [fmt.Stringer] interface.
+func (f ManifestFormat) String() string {
+	switch f {
+	case ManifestSHA256Sum:
+		return "sha256sum"
+	case ManifestJSON:
+		return "json"
+	default:
+		return "ManifestFormat(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+// ManifestEntry contains the checksum of a file in the manifest.
+type ManifestEntry struct {
+	// Slash-separated path relative to the dir.
+	Path string `json:"path"`
+	// Size of the file. It's -1 if the size is unknown(e.g. loaded from the sha256sum format).
+	Size int64 `json:"size"`
+	// Modification time of the file. It's zero if the time is unknown.
+	ModTime time.Time `json:"mod_time,omitzero"`
+	// Hex-encoded SHA-256 checksum of the file.
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest contains the checksums of the files in a dir.
+type Manifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+// ManifestReport contains the result of verifying a dir against a manifest.
+// The paths are slash-separated and relative to the dir.
+type ManifestReport struct {
+	// Files in the manifest but not in the dir.
+	Missing []string
+	// Files in the dir but not in the manifest.
+	Extra []string
+	// Files whose size or checksum does not match the manifest.
+	Mismatched []string
+}
+
+// OK reports whether the dir matches the manifest.
+func (r *ManifestReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// CreateManifest computes the checksums of the files in dir and returns the manifest.
+// It walks dir with the same filter as [CopyDirWithOptions](e.g. Options.Exts and Options.Symlinks).
+// Symlinks which are not followed and special files are not included.
+// opts: options of the copy. Leave it nil to use the default options.
+func CreateManifest(ctx context.Context, dir string, opts *Options) (*Manifest, error) {
+	opts = opts.orDefault()
+
+	var files []string
+	err := walkManifestFiles(dir, opts, "", func(rel string) {
+		files = append(files, rel)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buildManifest(ctx, dir, files, nil, opts.Buf)
+}
+
+// LoadManifest loads the manifest from the file in sha256sum or JSON format.
+func LoadManifest(name string) (*Manifest, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, &fs.PathError{Op: "parse", Path: name, Err: errors.Join(ErrInvalidManifest, err)}
+		}
+		return m, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		entry, ok := parseSHA256SumLine(line)
+		if !ok {
+			return nil, &fs.PathError{Op: "parse", Path: name, Err: ErrInvalidManifest}
+		}
+		m.Files = append(m.Files, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Save saves the manifest to the file atomically in the format.
+func (m *Manifest) Save(name string, format ManifestFormat) error {
+	var buf bytes.Buffer
+	if err := m.Write(&buf, format); err != nil {
+		return err
+	}
+	return writeFileAtomic(name, buf.Bytes())
+}
+
+// Write writes the manifest to w in the format.
+func (m *Manifest) Write(w io.Writer, format ManifestFormat) error {
+	switch format {
+	case ManifestJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	case ManifestSHA256Sum:
+		bw := bufio.NewWriter(w)
+		for _, entry := range m.Files {
+			bw.WriteString(formatSHA256SumLine(entry))
+		}
+		return bw.Flush()
+	default:
+		return errors.ErrUnsupported
+	}
+}
+
+// VerifyManifest verifies the files in dir against the manifest file and reports missing, extra and mismatched files.
+// It walks dir with the same filter as [CreateManifest], and the manifest file itself is ignored if it's in dir.
+// opts: options of the copy. Leave it nil to use the default options.
+func VerifyManifest(ctx context.Context, dir, name string, opts *Options) (*ManifestReport, error) {
+	opts = opts.orDefault()
+
+	m, err := LoadManifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]ManifestEntry{}
+	for _, entry := range m.Files {
+		entries[entry.Path] = entry
+	}
+
+	r := &ManifestReport{}
+	found := map[string]bool{}
+	var files []string
+
+	err = walkManifestFiles(dir, opts, name, func(rel string) {
+		if _, ok := entries[rel]; !ok {
+			r.Extra = append(r.Extra, rel)
+			return
+		}
+		found[rel] = true
+		files = append(files, rel)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range m.Files {
+		if !found[entry.Path] {
+			r.Missing = append(r.Missing, entry.Path)
+		}
+	}
+
+	for _, rel := range files {
+		entry := entries[rel]
+		name := filepath.Join(dir, filepath.FromSlash(rel))
+
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip computing the checksum if the size does not match.
+		if entry.Size >= 0 && fi.Size() != entry.Size {
+			r.Mismatched = append(r.Mismatched, rel)
+			continue
+		}
+
+		sum, err := fileSHA256(ctx, osSource{}, name, opts.Buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.EqualFold(hex.EncodeToString(sum), entry.SHA256) {
+			r.Mismatched = append(r.Mismatched, rel)
+		}
+	}
+
+	return r, nil
+}
+
+// walkManifestFiles walks dir with the filter of the options and calls fn with the relative path of each regular file.
+// ignore: file to ignore(e.g. the manifest file itself). Leave it empty to include all files.
+func walkManifestFiles(dir string, opts *Options, ignore string, fn func(rel string)) error {
+	s := osSource{}
+	f := newFileFilter(s, opts)
+
+	if ignore != "" {
+		ignore, _ = filepath.Abs(ignore)
+	}
+
+	return walk(s, dir, opts.Symlinks == SymlinkFollow, func(p string, fi fs.FileInfo) error {
+		rel, err := s.rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			if skip, err := f.walkDir(p, rel, fi); err != nil || skip {
+				if skip {
+					return fs.SkipDir
+				}
+				return err
+			}
+			return nil
+		}
+
+		// Symlinks which are not followed and special files are not included.
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		if ok, err := f.matchFile(p, rel, fi); err != nil || !ok {
+			return err
+		}
+
+		if ignore != "" {
+			if abs, _ := filepath.Abs(p); abs == ignore {
+				return nil
+			}
+		}
+
+		fn(rel)
+		return nil
+	})
+}
+
+// buildManifest creates the manifest of the files in dir.
+// files: slash-separated paths relative to dir.
+// sums: SHA-256 checksums computed while copying. The checksums of the other files are computed by reading the files.
+func buildManifest(ctx context.Context, dir string, files []string, sums map[string][]byte, buf []byte) (*Manifest, error) {
+	m := &Manifest{Files: []ManifestEntry{}}
+
+	for _, rel := range files {
+		name := filepath.Join(dir, filepath.FromSlash(rel))
+
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+
+		sum, ok := sums[rel]
+		if !ok {
+			if sum, err = fileSHA256(ctx, osSource{}, name, buf); err != nil {
+				return nil, err
+			}
+		}
+
+		m.Files = append(m.Files, ManifestEntry{
+			Path:    rel,
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+			SHA256:  hex.EncodeToString(sum),
+		})
+	}
+
+	return m, nil
+}
+
+// fileSHA256 returns the SHA-256 checksum of the file in the source.
+func fileSHA256(ctx context.Context, s source, name string, buf []byte) ([]byte, error) {
+	f, err := s.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = iocopy.CopyBuffer(ctx, h, f, buf); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// formatSHA256SumLine returns the line of the entry in sha256sum format.
+// Like GNU coreutils, the line starts with a backslash if the path contains backslashes or newlines which are escaped.
+func formatSHA256SumLine(entry ManifestEntry) string {
+	p := entry.Path
+	prefix := ""
+	if strings.ContainsAny(p, "\\\n") {
+		prefix = "\\"
+		p = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(p)
+	}
+	return prefix + entry.SHA256 + "  " + p + "\n"
+}
+
+// parseSHA256SumLine parses the line in sha256sum format.
+// Both text(" ") and binary("*") mode indicators are accepted.
+func parseSHA256SumLine(line string) (ManifestEntry, bool) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	if len(line) < sha256.Size*2+3 || line[sha256.Size*2] != ' ' {
+		return ManifestEntry{}, false
+	}
+
+	sum := line[:sha256.Size*2]
+	if _, err := hex.DecodeString(sum); err != nil {
+		return ManifestEntry{}, false
+	}
+
+	if mode := line[sha256.Size*2+1]; mode != ' ' && mode != '*' {
+		return ManifestEntry{}, false
+	}
+
+	p := line[sha256.Size*2+2:]
+	if escaped {
+		p = strings.NewReplacer("\\\\", "\\", "\\n", "\n").Replace(p)
+	}
+
+	return ManifestEntry{Path: p, Size: -1, SHA256: strings.ToLower(sum)}, true
+}
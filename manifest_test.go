@@ -0,0 +1,184 @@
+package cp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSHA256SumLine(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello"))
+	hexSum := hex.EncodeToString(sum[:])
+
+	// The paths are escaped like GNU coreutils and parsed back.
+	for _, tc := range []struct {
+		path string
+		line string
+	}{
+		{"a.txt", hexSum + "  a.txt\n"},
+		{"dir/b c.txt", hexSum + "  dir/b c.txt\n"},
+		{`back\slash`, `\` + hexSum + `  back\\slash` + "\n"},
+		{"new\nline", `\` + hexSum + `  new\nline` + "\n"},
+		{"both\\\n", `\` + hexSum + `  both\\\n` + "\n"},
+	} {
+		line := formatSHA256SumLine(ManifestEntry{Path: tc.path, Size: 5, SHA256: hexSum})
+		if line != tc.line {
+			t.Errorf("formatSHA256SumLine(%q) = %q, want %q", tc.path, line, tc.line)
+		}
+
+		entry, ok := parseSHA256SumLine(strings.TrimSuffix(line, "\n"))
+		if !ok || entry != (ManifestEntry{Path: tc.path, Size: -1, SHA256: hexSum}) {
+			t.Errorf("parseSHA256SumLine(%q) = %+v, %v, want path %q", line, entry, ok, tc.path)
+		}
+	}
+
+	for _, tc := range []struct {
+		line string
+		ok   bool
+		want ManifestEntry
+	}{
+		// Binary mode and upper-cased checksums.
+		{strings.ToUpper(hexSum) + " *a.bin", true, ManifestEntry{Path: "a.bin", Size: -1, SHA256: hexSum}},
+		{hexSum + "  ", false, ManifestEntry{}},
+		{hexSum[1:] + "  a.txt", false, ManifestEntry{}},
+		{"x" + hexSum[1:] + "  a.txt", false, ManifestEntry{}},
+		{hexSum + " -a.txt", false, ManifestEntry{}},
+		{hexSum + "\ta.txt", false, ManifestEntry{}},
+	} {
+		entry, ok := parseSHA256SumLine(tc.line)
+		if ok != tc.ok || entry != tc.want {
+			t.Errorf("parseSHA256SumLine(%q) = %+v, %v, want %+v, %v", tc.line, entry, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+// newManifestDir creates a dir with the files.
+func newManifestDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := newManifestDir(t, map[string]string{"a.txt": "hello", "sub/b.txt": "world!"})
+
+	m, err := CreateManifest(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatalf("CreateManifest() error: %v", err)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("CreateManifest() returns %v files, want 2", len(m.Files))
+	}
+	for _, entry := range m.Files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := sha256.Sum256(data); entry.SHA256 != hex.EncodeToString(sum[:]) || entry.Size != int64(len(data)) || entry.ModTime.IsZero() {
+			t.Errorf("entry = %+v, want size %v, SHA256 %x", entry, len(data), sum)
+		}
+	}
+
+	for _, format := range []ManifestFormat{ManifestJSON, ManifestSHA256Sum} {
+		name := filepath.Join(t.TempDir(), "manifest")
+		if err := m.Save(name, format); err != nil {
+			t.Fatalf("%v: Save() error: %v", format, err)
+		}
+
+		loaded, err := LoadManifest(name)
+		if err != nil {
+			t.Fatalf("%v: LoadManifest() error: %v", format, err)
+		}
+		if len(loaded.Files) != len(m.Files) {
+			t.Fatalf("%v: LoadManifest() returns %v files, want %v", format, len(loaded.Files), len(m.Files))
+		}
+
+		// The size and the modification time are only kept in the JSON format.
+		for i, entry := range loaded.Files {
+			want := m.Files[i]
+			if format == ManifestSHA256Sum {
+				if entry != (ManifestEntry{Path: want.Path, Size: -1, SHA256: want.SHA256}) {
+					t.Errorf("%v: entry = %+v, want path %v, size -1, SHA256 %v", format, entry, want.Path, want.SHA256)
+				}
+				continue
+			}
+
+			if entry.Path != want.Path || entry.Size != want.Size || !entry.ModTime.Equal(want.ModTime) || entry.SHA256 != want.SHA256 {
+				t.Errorf("%v: entry = %+v, want %+v", format, entry, want)
+			}
+		}
+	}
+
+	// Invalid manifests.
+	for _, content := range []string{"{\"files\": [", "not a checksum line\n"} {
+		name := filepath.Join(t.TempDir(), "manifest")
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadManifest(name); !errors.Is(err, ErrInvalidManifest) {
+			t.Errorf("LoadManifest(%q) error = %v, want ErrInvalidManifest", content, err)
+		}
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	for _, format := range []ManifestFormat{ManifestJSON, ManifestSHA256Sum} {
+		dir := newManifestDir(t, map[string]string{
+			"a.txt":     "a",
+			"b.txt":     "hello",
+			"c.txt":     "world",
+			"sub/d.txt": "d",
+		})
+
+		m, err := CreateManifest(context.Background(), dir, nil)
+		if err != nil {
+			t.Fatalf("%v: CreateManifest() error: %v", format, err)
+		}
+
+		// The manifest file in dir is ignored.
+		name := filepath.Join(dir, "SHA256SUMS")
+		if err = m.Save(name, format); err != nil {
+			t.Fatalf("%v: Save() error: %v", format, err)
+		}
+
+		r, err := VerifyManifest(context.Background(), dir, name, nil)
+		if err != nil || !r.OK() {
+			t.Fatalf("%v: VerifyManifest() = %+v, %v, want OK", format, r, err)
+		}
+
+		// a.txt is missing, e.txt is extra, b.txt is changed with the same size and c.txt is changed with a different size.
+		if err = os.Remove(filepath.Join(dir, "a.txt")); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{"b.txt": "HELLO", "c.txt": "world!", "sub/e.txt": "e"} {
+			if err = os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r, err = VerifyManifest(context.Background(), dir, name, nil)
+		if err != nil {
+			t.Fatalf("%v: VerifyManifest() error: %v", format, err)
+		}
+		if r.OK() || !slices.Equal(r.Missing, []string{"a.txt"}) || !slices.Equal(r.Extra, []string{"sub/e.txt"}) ||
+			!slices.Equal(r.Mismatched, []string{"b.txt", "c.txt"}) {
+			t.Errorf("%v: VerifyManifest() = %+v, want missing [a.txt], extra [sub/e.txt], mismatched [b.txt c.txt]", format, r)
+		}
+	}
+}
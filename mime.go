@@ -0,0 +1,113 @@
+package cp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Number of bytes to read from the beginning of a file to detect the MIME type.
+	sniffLen = 512
+)
+
+// magic is the magic number of a file type which is not detected by [http.DetectContentType].
+type magic struct {
+	// Offset of the magic number.
+	offset int
+	sig    []byte
+	mime   string
+}
+
+var magics = []magic{
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("8BPS"), "image/vnd.adobe.photoshop"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{0, []byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\x28\xb5\x2f\xfd"), "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+}
+
+// ftypBrands maps the major brands of ISO base media files to the MIME types.
+// The brands not listed are detected by [http.DetectContentType].
+var ftypBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"avif": "image/avif",
+	"qt  ": "video/quicktime",
+	"M4A ": "audio/mp4",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+	"3g2a": "video/3gpp2",
+}
+
+// ebmlSig is the signature of EBML files(Matroska and WebM).
+var ebmlSig = []byte("\x1a\x45\xdf\xa3")
+
+// Number of bytes of the EBML header to search the doc type.
+const ebmlHeaderLen = 64
+
+// sniffMIMEType detects the MIME type of the content by its first bytes.
+// It uses [http.DetectContentType] and the magic numbers of common archive and media types.
+// The parameters(e.g. charset) are removed from the MIME type.
+func sniffMIMEType(head []byte) string {
+	// Check the major brand of ISO base media files.
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		if t, ok := ftypBrands[string(head[8:12])]; ok {
+			return t
+		}
+	}
+
+	// http.DetectContentType reports all EBML files as WebM.
+	if bytes.HasPrefix(head, ebmlSig) && bytes.Contains(head[:min(len(head), ebmlHeaderLen)], []byte("matroska")) {
+		return "video/x-matroska"
+	}
+
+	for _, m := range magics {
+		if len(head) >= m.offset+len(m.sig) && bytes.Equal(head[m.offset:m.offset+len(m.sig)], m.sig) {
+			return m.mime
+		}
+	}
+
+	t := http.DetectContentType(head)
+	if mediaType, _, err := mime.ParseMediaType(t); err == nil {
+		return mediaType
+	}
+	return t
+}
+
+// readMIMEType reads the first bytes of r and detects the MIME type.
+func readMIMEType(r io.Reader) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return sniffMIMEType(head[:n]), nil
+}
+
+// matchMIMETypes reports whether the MIME type matches one of the types or categories.
+// A category matches all the types of it, e.g. "image" or "image/*" matches "image/png".
+func matchMIMETypes(t string, types []string) bool {
+	category, _, _ := strings.Cut(t, "/")
+
+	for _, pattern := range types {
+		pattern = strings.TrimSuffix(pattern, "/*")
+		if strings.Contains(pattern, "/") {
+			if strings.EqualFold(pattern, t) {
+				return true
+			}
+		} else if strings.EqualFold(pattern, category) {
+			return true
+		}
+	}
+	return false
+}
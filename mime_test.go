@@ -0,0 +1,103 @@
+package cp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// ftyp returns the head of an ISO base media file with the major brand and the compatible brands "mif1" and "mp41".
+func ftyp(brand string) []byte {
+	return []byte("\x00\x00\x00\x18ftyp" + brand + "\x00\x00\x00\x00mif1mp41")
+}
+
+// ebml returns the head of an EBML file with the doc type.
+func ebml(docType string) []byte {
+	return append([]byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x88"), docType...)
+}
+
+// tarHead returns the first block of a tar file which contains the "ustar" magic at offset 257.
+func tarHead() []byte {
+	head := make([]byte, 512)
+	copy(head, "a.txt")
+	copy(head[257:], "ustar\x0000")
+	return head
+}
+
+func TestSniffMIMEType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"heic", ftyp("heic"), "image/heic"},
+		{"heif", ftyp("mif1"), "image/heif"},
+		{"avif", ftyp("avif"), "image/avif"},
+		{"quicktime", ftyp("qt  "), "video/quicktime"},
+		{"m4a", ftyp("M4A "), "audio/mp4"},
+		{"3gp", ftyp("3gp5"), "video/3gpp"},
+		// The brands not listed are detected by http.DetectContentType.
+		{"mp4", ftyp("isom"), "video/mp4"},
+		{"matroska", ebml("matroska"), "video/x-matroska"},
+		{"webm", ebml("webm"), "video/webm"},
+		{"tar", tarHead(), "application/x-tar"},
+		{"short tar", tarHead()[:260], "application/octet-stream"},
+		{"tiff", []byte("II*\x00\x08\x00\x00\x00"), "image/tiff"},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), "audio/flac"},
+		{"7z", []byte("7z\xbc\xaf\x27\x1c\x00\x04"), "application/x-7z-compressed"},
+		{"xz", []byte("\xfd7zXZ\x00\x00\x04"), "application/x-xz"},
+		{"zstd", []byte("\x28\xb5\x2f\xfd\x04\x00"), "application/zstd"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "image/png"},
+		{"gzip", []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00"), "application/x-gzip"},
+		// The parameters are removed.
+		{"text", []byte("hello, world!\n"), "text/plain"},
+		{"empty", nil, "text/plain"},
+		{"binary", bytes.Repeat([]byte{0, 1, 2, 3}, 16), "application/octet-stream"},
+	} {
+		if got := sniffMIMEType(tc.head); got != tc.want {
+			t.Errorf("%v: sniffMIMEType() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReadMIMEType(t *testing.T) {
+	// Only the first bytes are read.
+	head := append(tarHead(), bytes.Repeat([]byte{0}, 4096)...)
+	r := bytes.NewReader(head)
+
+	got, err := readMIMEType(r)
+	if err != nil || got != "application/x-tar" {
+		t.Errorf("readMIMEType() = %v, %v, want application/x-tar", got, err)
+	}
+	if r.Len() != len(head)-sniffLen {
+		t.Errorf("readMIMEType() reads %v bytes, want %v", len(head)-r.Len(), sniffLen)
+	}
+
+	// The file is shorter than sniffLen.
+	if got, err = readMIMEType(bytes.NewReader([]byte("hi"))); err != nil || got != "text/plain" {
+		t.Errorf("readMIMEType() = %v, %v, want text/plain", got, err)
+	}
+}
+
+func TestMatchMIMETypes(t *testing.T) {
+	for _, tc := range []struct {
+		t     string
+		types []string
+		want  bool
+	}{
+		{"image/png", []string{"image"}, true},
+		{"image/png", []string{"image/*"}, true},
+		{"image/png", []string{"IMAGE"}, true},
+		{"image/png", []string{"image/png"}, true},
+		{"image/png", []string{"Image/PNG"}, true},
+		{"image/png", []string{"image/jpeg"}, false},
+		{"image/png", []string{"video", "image/jpeg"}, false},
+		{"image/png", []string{"video", "image/png"}, true},
+		{"video/mp4", []string{"image/*"}, false},
+		{"application/x-tar", []string{"application"}, true},
+		{"text/plain", nil, false},
+	} {
+		if got := matchMIMETypes(tc.t, tc.types); got != tc.want {
+			t.Errorf("matchMIMETypes(%v, %q) = %v, want %v", tc.t, tc.types, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package cp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DeleteMode specifies when to delete the extraneous files and dirs in dst which do not exist in src.
+type DeleteMode int
+
+const (
+	// DeleteNone never deletes files in dst.
+	DeleteNone DeleteMode = iota
+	// DeleteBefore deletes the extraneous files before copying.
+	// It frees the space of dst first, and a dst dir whose source is a file is replaced.
+	DeleteBefore
+	// DeleteAfter deletes the extraneous files after the copy is done.
+	// Nothing is deleted if the copy fails.
+	DeleteAfter
+)
+
+// String implements [fmt.Stringer] interface.
+func (m DeleteMode) String() string {
+	switch m {
+	case DeleteNone:
+		return "none"
+	case DeleteBefore:
+		return "before"
+	case DeleteAfter:
+		return "after"
+	default:
+		return "DeleteMode(" + strconv.Itoa(int(m)) + ")"
+	}
+}
+
+// extraneousEntry is an extraneous file or dir in dst.
+type extraneousEntry struct {
+	// Slash-separated path relative to dst.
+	rel string
+	// Path of the file or dir.
+	p  string
+	fi fs.FileInfo
+}
+
+// findExtraneous returns the extraneous files and dirs in dst which do not exist in src of the source.
+// A dst file is also extraneous if it's a dir and its source is not, or vice versa.
+// The dst files and dirs excluded by Exclude, the ignore files of src and Filter.SkipHidden are kept,
+// or they're extraneous even if they exist in src if Options.DeleteExcluded is set.
+// The entries of a dir are returned before the dir, and the dir is not returned if it contains entries to keep.
+// keep: dst paths to keep, e.g. the files renamed by the BeforeFile callback. It's optional.
+func findExtraneous(s source, src, dst string, opts *Options, keep map[string]bool) ([]extraneousEntry, error) {
+	if _, err := os.Stat(dst); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The trash dir, the checkpoint file and the manifest file may be in dst.
+	protected := map[string]bool{}
+	for _, name := range []string{opts.Trash, opts.Checkpoint, opts.Manifest} {
+		if name != "" {
+			if abs, err := filepath.Abs(name); err == nil {
+				protected[abs] = true
+			}
+		}
+	}
+
+	// Filter to find the excluded files and dirs in dst.
+	f := newFileFilter(s, opts)
+	if err := f.loadIgnores(src, "."); err != nil {
+		return nil, err
+	}
+
+	ds := osSource{}
+	var entries []extraneousEntry
+
+	// Paths of the extraneous entries.
+	found := map[string]bool{}
+	// Paths of the extraneous dirs whose entries are all extraneous.
+	dirs := map[string]bool{}
+
+	// isProtected reports whether the dst file or dir p should be kept with its contents.
+	// The excluded ones are kept unless DeleteExcluded is set.
+	isProtected := func(p, rel string, fi fs.FileInfo) bool {
+		if keep[p] || matchRules(opts.Protect, rel, fi.IsDir()) || (!opts.DeleteExcluded && f.excluded(rel, fi)) {
+			return true
+		}
+
+		abs, err := filepath.Abs(p)
+		return err == nil && protected[abs]
+	}
+
+	// isExtraneous reports whether the dst file or dir does not exist in src.
+	isExtraneous := func(p, rel string, fi fs.FileInfo) (bool, error) {
+		// Only the entries planned to delete are deleted while executing a plan.
+		if opts.planned != nil && !opts.planned[rel] {
+			return false, nil
+		}
+
+		// The excluded ones are treated as if they don't exist in src.
+		if dirs[filepath.Dir(p)] || f.excluded(rel, fi) {
+			return true, nil
+		}
+
+		stat := s.lstat
+		if opts.Symlinks == SymlinkFollow {
+			stat = s.stat
+		}
+
+		sfi, err := stat(s.join(src, rel))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return true, nil
+			}
+			return false, err
+		}
+		return sfi.IsDir() != fi.IsDir(), nil
+	}
+
+	err := walkPost(ds, dst, false, func(p string, fi fs.FileInfo) error {
+		rel, err := ds.rel(dst, p)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if isProtected(p, rel, fi) {
+			if fi.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		extraneous, err := isExtraneous(p, rel, fi)
+		if err != nil {
+			return err
+		}
+
+		// Dirs are deleted after their entries.
+		if fi.IsDir() {
+			dirs[p] = extraneous
+
+			// The ignore file is only loaded from the dir which exists in src.
+			sp := s.join(src, rel)
+			if extraneous {
+				sp = ""
+			}
+			return f.loadIgnores(sp, rel)
+		}
+
+		if extraneous {
+			entries = append(entries, extraneousEntry{rel: rel, p: p, fi: fi})
+			found[p] = true
+		}
+		return nil
+	}, func(p string, fi fs.FileInfo) error {
+		rel, err := ds.rel(dst, p)
+		if err != nil || rel == "." || !dirs[p] {
+			return err
+		}
+
+		// Keep the dir which contains the entries to keep.
+		children, err := os.ReadDir(p)
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			if !found[filepath.Join(p, child.Name())] {
+				return nil
+			}
+		}
+
+		entries = append(entries, extraneousEntry{rel: rel, p: p, fi: fi})
+		found[p] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// deleteExtraneous deletes the extraneous files and dirs, or moves the files into the trash dir.
+// The dirs are removed after their entries are deleted.
+func deleteExtraneous(entries []extraneousEntry, opts *Options) error {
+	for _, e := range entries {
+		var err error
+
+		if e.fi.IsDir() {
+			err = os.Remove(e.p)
+		} else if opts.Trash != "" {
+			err = moveToTrash(e.p, filepath.Join(opts.Trash, filepath.FromSlash(e.rel)))
+		} else {
+			err = os.Remove(e.p)
+		}
+
+		opts.afterFile(&FileResult{Dst: e.p, Outcome: OutcomeDeleted, Err: err})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveToTrash moves the file p to the path in the trash dir.
+// An existing file in the trash dir is replaced.
+func moveToTrash(p, trashed string) error {
+	if err := os.MkdirAll(filepath.Dir(trashed), 0755); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(trashed); err != nil {
+		return err
+	}
+	return os.Rename(p, trashed)
+}
+
+// mirror deletes the extraneous files and dirs in dst if the mode matches Options.Delete.
+// keep: dst paths to keep. It's optional.
+func mirror(s source, src, dst string, opts *Options, mode DeleteMode, keep map[string]bool) error {
+	if opts.Delete != mode {
+		return nil
+	}
+
+	entries, err := findExtraneous(s, src, dst, opts, keep)
+	if err != nil {
+		return err
+	}
+	return deleteExtraneous(entries, opts)
+}
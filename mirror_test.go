@@ -0,0 +1,256 @@
+package cp_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/northbright/cp"
+)
+
+// writeFiles writes the files by the slash-separated paths relative to the dir.
+// The paths ending with "/" are created as dirs.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkFiles checks that the files exist with the contents and the paths in gone do not exist.
+func checkFiles(t *testing.T, dir string, files map[string]string, gone []string) {
+	t.Helper()
+
+	for name, content := range files {
+		if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); err != nil || string(data) != content {
+			t.Errorf("%v = %q, %v, want %q", name, data, err, content)
+		}
+	}
+	for _, name := range gone {
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name))); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Lstat(%v) error = %v, want ErrNotExist", name, err)
+		}
+	}
+}
+
+// deletedRecorder records the dst files reported with OutcomeDeleted.
+type deletedRecorder struct {
+	dst     string
+	deleted []string
+}
+
+// afterFile records the slash-separated path relative to dst of the deleted file.
+func (r *deletedRecorder) afterFile(res *cp.FileResult) {
+	if res.Outcome != cp.OutcomeDeleted {
+		return
+	}
+	if rel, err := filepath.Rel(r.dst, res.Dst); err == nil {
+		r.deleted = append(r.deleted, filepath.ToSlash(rel))
+	}
+}
+
+func TestCopyDirDelete(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+		"x":         "x",
+	})
+
+	for _, tc := range []struct {
+		mode cp.DeleteMode
+		dst  map[string]string
+		gone []string
+		// Deleted files and dirs in the order reported.
+		deleted []string
+	}{
+		{
+			cp.DeleteBefore,
+			map[string]string{
+				"a.txt":         "old",
+				"old.txt":       "old",
+				"old/c.txt":     "old",
+				"sub/stale.txt": "old",
+				"x/y.txt":       "old",
+				"data.keep":     "keep",
+			},
+			[]string{"old.txt", "old", "sub/stale.txt"},
+			// The dst dir whose source is a file is deleted with its entries first.
+			[]string{"old/c.txt", "old", "old.txt", "sub/stale.txt", "x/y.txt", "x"},
+		},
+		{
+			cp.DeleteAfter,
+			map[string]string{
+				"a.txt":         "old",
+				"old.txt":       "old",
+				"old/c.txt":     "old",
+				"sub/stale.txt": "old",
+				"data.keep":     "keep",
+			},
+			[]string{"old.txt", "old", "sub/stale.txt"},
+			[]string{"old/c.txt", "old", "old.txt", "sub/stale.txt"},
+		},
+	} {
+		dst := filepath.Join(t.TempDir(), "dst")
+		writeFiles(t, dst, tc.dst)
+
+		r := &deletedRecorder{dst: dst}
+		opts := &cp.Options{
+			Delete:    tc.mode,
+			Protect:   []cp.Rule{{Glob: "*.keep"}},
+			AfterFile: r.afterFile,
+		}
+
+		if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts); err != nil {
+			t.Fatalf("%v: CopyDirWithOptions() error: %v", tc.mode, err)
+		}
+
+		checkFiles(t, dst, map[string]string{"a.txt": "a", "sub/b.txt": "b", "x": "x", "data.keep": "keep"}, tc.gone)
+		if !slices.Equal(r.deleted, tc.deleted) {
+			t.Errorf("%v: deleted %q, want %q", tc.mode, r.deleted, tc.deleted)
+		}
+	}
+}
+
+func TestCopyDirDeleteAfterFailure(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	writeFiles(t, dst, map[string]string{"old.txt": "old"})
+
+	opts := &cp.Options{
+		Delete: cp.DeleteAfter,
+		BeforeFile: func(op *cp.FileOp) error {
+			if filepath.Base(op.Src) == "b.txt" {
+				return fs.ErrPermission
+			}
+			return nil
+		},
+	}
+
+	// Nothing is deleted if the copy fails.
+	if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts); !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("CopyDirWithOptions() error = %v, want ErrPermission", err)
+	}
+	checkFiles(t, dst, map[string]string{"old.txt": "old"}, nil)
+}
+
+func TestCopyDirDeleteTrash(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"a.txt": "a"})
+
+	for _, inside := range []bool{true, false} {
+		dst := filepath.Join(t.TempDir(), "dst")
+		writeFiles(t, dst, map[string]string{"old.txt": "old", "old/c.txt": "c"})
+
+		trash := filepath.Join(t.TempDir(), "trash")
+		if inside {
+			trash = filepath.Join(dst, ".trash")
+		}
+
+		opts := &cp.Options{Delete: cp.DeleteAfter, Trash: trash}
+
+		// The trash dir in dst is not deleted by the next copy.
+		for range 2 {
+			if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts); err != nil {
+				t.Fatalf("inside %v: CopyDirWithOptions() error: %v", inside, err)
+			}
+		}
+
+		checkFiles(t, dst, map[string]string{"a.txt": "a"}, []string{"old.txt", "old"})
+		checkFiles(t, trash, map[string]string{"old.txt": "old", "old/c.txt": "c"}, nil)
+	}
+}
+
+func TestCopyDirDeleteKeepsRenamed(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	for _, workers := range []int{0, 4} {
+		dst := filepath.Join(t.TempDir(), "dst")
+		writeFiles(t, dst, map[string]string{"old.txt": "old"})
+
+		opts := &cp.Options{
+			Delete:  cp.DeleteAfter,
+			Workers: workers,
+			// Copy a.txt to renamed.txt which does not exist in src.
+			BeforeFile: func(op *cp.FileOp) error {
+				if filepath.Base(op.Src) == "a.txt" {
+					op.Dst = filepath.Join(dst, "renamed.txt")
+				}
+				return nil
+			},
+		}
+
+		if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts); err != nil {
+			t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+		}
+		checkFiles(t, dst, map[string]string{"renamed.txt": "a", "b.txt": "b"}, []string{"old.txt", "a.txt"})
+	}
+}
+
+func TestCopyDirDeleteKeepsExcluded(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{
+		"a.txt":          "a",
+		".cpignore":      "*.log\n",
+		"sub/b.txt":      "b",
+		"sub/.cpignore":  "*.tmp\n",
+		"node_modules/":  "",
+		"other/c.txt":    "c",
+		"other/.hidden/": "",
+	})
+
+	extraneous := map[string]string{
+		"node_modules/stale.js": "stale",
+		"debug.log":             "log",
+		"sub/x.tmp":             "tmp",
+		"gone/debug.log":        "log",
+		".cache/x":              "cache",
+	}
+
+	for _, deleteExcluded := range []bool{false, true} {
+		dst := filepath.Join(t.TempDir(), "dst")
+		writeFiles(t, dst, extraneous)
+		writeFiles(t, dst, map[string]string{"old.txt": "old", "gone/y.txt": "y", "x.tmp": "tmp"})
+
+		opts := &cp.Options{
+			Delete:         cp.DeleteAfter,
+			DeleteExcluded: deleteExcluded,
+			Exclude:        []cp.Rule{{Glob: "node_modules/"}},
+			IgnoreFile:     ".cpignore",
+			Filter:         &cp.Filter{SkipHidden: true},
+		}
+
+		if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts); err != nil {
+			t.Fatalf("DeleteExcluded %v: CopyDirWithOptions() error: %v", deleteExcluded, err)
+		}
+
+		// x.tmp is not ignored by sub/.cpignore, and gone/y.txt is not ignored at all.
+		gone := []string{"old.txt", "gone/y.txt", "x.tmp"}
+		if deleteExcluded {
+			checkFiles(t, dst, map[string]string{"a.txt": "a"}, append(gone, "node_modules", "debug.log", "sub/x.tmp", "gone", ".cache"))
+		} else {
+			checkFiles(t, dst, extraneous, gone)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build unix && !aix && !hurd && !freebsd
+
+package cp
+
+import (
+	"syscall"
+)
+
+// mknod wraps syscall.Mknod which has different types of dev on platforms.
+func mknod(path string, mode uint32, dev uint64) error {
+	return syscall.Mknod(path, mode, int(dev))
+}
@@ -0,0 +1,10 @@
+package cp
+
+import (
+	"syscall"
+)
+
+// mknod wraps syscall.Mknod which has different types of dev on platforms.
+func mknod(path string, mode uint32, dev uint64) error {
+	return syscall.Mknod(path, mode, dev)
+}
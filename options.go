@@ -0,0 +1,151 @@
+package cp
+
+import (
+	"hash"
+	"time"
+
+	"github.com/northbright/iocopy"
+)
+
+// Options contains the options of the copy functions.
+// The zero value of Options uses the default of each field, which differs from the functions without options in the following ways:
+//   - Symlinks defaults to SymlinkFollow, while [CopyFile] and its variants reject symlinks with ErrNotRegularFile.
+//     Set SymlinkSkip to get the same behavior with [CopyFileWithOptions].
+//   - SpecialFiles defaults to SpecialFileSkip, while the dir copies without options tried to read special files(e.g. named pipes).
+//   - FastPath defaults to FastPathAuto, which uses reflink and copy_file_range when available.
+//     The content of dst is the same, but it's not copied through the buffer. Set FastPathNever to always copy through the buffer.
+type Options struct {
+	// Desired file extensions for directory copies. Leave it nil or empty for all files.
+	// It's applied in addition to Filter.Exts.
+	Exts []string
+	// Filter to select the files of dir copies by extension, size, modification time, hidden status and a custom predicate.
+	// Leave it nil for all files.
+	Filter *Filter
+	// Rules to select the files of dir copies. Leave it nil or empty for all files.
+	// A file is copied if it matches any of the rules. Dirs are always walked unless they're excluded.
+	Include []Rule
+	// Rules to exclude the files and dirs of dir copies. The excluded dirs are skipped with their contents.
+	Exclude []Rule
+	// Name of the ignore files in gitignore syntax(e.g. ".cpignore") to exclude the files and dirs of dir copies.
+	// The ignore files are discovered in src and its sub-dirs, and the patterns apply to the dir of the ignore file and below.
+	// Negation("!"), dir-only("/" suffix) and anchored(with "/") patterns are supported.
+	// The patterns of the deeper ignore files take precedence. Leave it empty to disable the ignore files.
+	IgnoreFile string
+	// Buffer used by the copy. Leave it nil to allocate one internally.
+	Buf []byte
+	// Callback on bytes written to report progress.
+	OnWritten iocopy.OnWrittenFunc
+	// Callback on progress events of dir copies, which contain the current file, rate and ETA.
+	// It's never called concurrently.
+	OnProgress func(p Progress)
+	// Channel to receive progress events of dir copies. The events are dropped if the channel is full,
+	// except the final event after the copy is done, which waits until it's received, FinalProgressTimeout expires or ctx is done.
+	// The channel is not closed by the copy.
+	ProgressChan chan<- Progress
+	// Minimum interval between progress events. Default is DefaultProgressInterval.
+	// The final event is always delivered to OnProgress after the copy is done successfully.
+	ProgressInterval time.Duration
+	// Maximum time to wait for the final event to be received from a full ProgressChan. Default is DefaultFinalProgressTimeout.
+	// Set it negative to drop the final event if the channel is full.
+	FinalProgressTimeout time.Duration
+	// File attributes to preserve on the destination files and dirs.
+	Preserve PreserveFlags
+	// Policy to handle symlinks. Default is SymlinkFollow.
+	Symlinks SymlinkPolicy
+	// Rewrite absolute symlink targets inside src to the corresponding paths inside dst.
+	// It only works with SymlinkPreserve while copying dirs of the local file system.
+	RewriteSymlinks bool
+	// Policy to handle special files(named pipes, sockets and devices) in dir copies. Default is SpecialFileSkip.
+	SpecialFiles SpecialFilePolicy
+	// Recreate hard links in dir copies instead of copying the content once per link.
+	// The content of each linked file is copied only once and counted once in DirInfoData.TotalSize.
+	// If BeforeFile skips the first name of a linked file, the content is copied for the next name
+	// and the total of the progress grows by its size.
+	HardLinks bool
+	// Make holes in the destination files instead of writing zeros.
+	// It uses SEEK_DATA and SEEK_HOLE on Linux and falls back to detect zero blocks.
+	Sparse bool
+	// Whether to use kernel fast paths(reflink and copy_file_range). Default is FastPathAuto.
+	// copy_file_range is not used when Sparse is set, because it may fill the holes.
+	FastPath FastPathMode
+	// Write each destination file into a temporary file in the same dir and rename it to the final name after a successful copy.
+	// Readers never see a partially written file with the final name.
+	// Atomic copies can not be resumed because the temporary file is removed on failure.
+	Atomic bool
+	// Flush the destination files to the storage by fsync before they're closed(and renamed).
+	Sync bool
+	// How to detect the unchanged files to skip in dir copies. Default is CompareNone.
+	// The unchanged files are skipped before BeforeFile is called and reported to AfterFile with OutcomeSkipped.
+	// They're not counted in the progress, so the progress is computed only over the files to transfer.
+	// Use [DirInfoWithDst] to get the totals of the files to transfer.
+	Compare CompareMode
+	// Policy to handle existing destination files. Default is OverwriteAlways.
+	// It's not applied while resuming a file copy.
+	Overwrite OverwritePolicy
+	// Callback after each file(including symlinks and special files) is copied, skipped, deleted or failed.
+	AfterFile func(r *FileResult)
+	// Mode to delete the extraneous files and dirs in dst which do not exist in src in dir copies, like "rsync --delete".
+	// Default is DeleteNone. The files in dst are kept if they exist in src, even if they're filtered out.
+	// The files and dirs in dst excluded by Exclude, the ignore files of src or Filter.SkipHidden are kept with their contents.
+	Delete DeleteMode
+	// Also delete the excluded files and dirs in dst even if they exist in src, like "rsync --delete-excluded".
+	// It only works with Delete.
+	DeleteExcluded bool
+	// Rules to protect the files and dirs in dst from deletion. The paths are relative to dst.
+	// The protected dirs are kept with their contents.
+	Protect []Rule
+	// Dir to move the deleted files into instead of removing them. The paths relative to dst are kept in the dir.
+	// It should be on the same file system as dst, and it's protected if it's in dst. Leave it empty to remove the files.
+	Trash string
+	// Callback before each file(including symlinks and special files) is copied in dir copies.
+	// It may skip the file or change the destination. Returning an error stops the copy.
+	BeforeFile func(op *FileOp) error
+	// Callback after the entries of each dir(including src) are copied in dir copies.
+	// It's called after the files are written even if they're copied in parallel.
+	// Returning an error stops the copy.
+	AfterDir func(src, dst string) error
+	// Checkpoint file to save the state of dir copies and files copied in chunks. Leave it empty to disable checkpoints.
+	// Use [ResumeCopyDir] or [ResumeCopyFSDir] to resume a dir copy from the checkpoint,
+	// and [ResumeCopyFile] or [ResumeCopyFSFile] to resume a file copied in chunks.
+	Checkpoint string
+	// Interval to save the checkpoint. Default is DefaultCheckpointInterval.
+	CheckpointInterval time.Duration
+	// How to check the destination file before resuming a copy. Default is ResumeCheckNone.
+	ResumeCheck ResumeCheck
+	// Hash algorithm to verify the copied files. Default is HashNone.
+	// The checksum of src is computed while copying, then dst is flushed and re-read to compare.
+	// The checksums are only reported in FileResult.Digest passed to AfterFile, so set AfterFile to collect the checksums of dir copies.
+	Verify HashAlgorithm
+	// Function to create the hashes for each copied file, e.g. to compute SHA-256 and MD5 at the same time.
+	// The content is written to the hashes while copying and the checksums are reported in FileResult.Sums passed to AfterFile.
+	Hashes func() []hash.Hash
+	// Manifest file to write the SHA-256 checksums of the copied files after a dir copy. Leave it empty to disable the manifest.
+	// It can be written next to or inside dst, and the paths in the manifest are relative to dst.
+	// Use [VerifyManifest] to verify dst against the manifest later.
+	Manifest string
+	// Format of the manifest file. Default is ManifestSHA256Sum.
+	ManifestFormat ManifestFormat
+	// Number of files copied concurrently in dir copies. Default is 0 which copies the files one by one.
+	// OnWritten and AfterFile are never called concurrently. Each worker allocates its own buffer of the same size as Buf.
+	// OnWritten reports the bytes of the completed files as prev and the bytes of the files being copied as current.
+	// Partially copied files are removed on failure and they're copied again from the start when the copy is resumed.
+	Workers int
+	// Number of chunks of a file copied concurrently by [CopyFileWithOptions] and [CopyFSFileWithOptions]. Default is 0 which copies the file sequentially.
+	// dst is preallocated and the chunks are copied with ReadAt and WriteAt.
+	// It's used only if the file is larger than ChunkSize and the source file implements [io.ReaderAt],
+	// and it's ignored when Sparse, Verify or hashes are set, or the copy is resumed from an offset.
+	ChunkWorkers int
+	// Size of the chunks of a file copied concurrently. Default is DefaultChunkSize.
+	ChunkSize int64
+
+	// Slash-separated paths of the entries to copy while executing a [Plan]. It's nil to copy all entries.
+	planned map[string]bool
+}
+
+// orDefault returns opts, or the zero value of Options if opts is nil.
+func (opts *Options) orDefault() *Options {
+	if opts == nil {
+		return &Options{}
+	}
+	return opts
+}
@@ -0,0 +1,184 @@
+package cp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrDstExists represents the error that dst exists while OverwriteError is set.
+	// It's wrapped in a [fs.PathError] which contains the path of dst.
+	ErrDstExists = errors.New("destination exists")
+)
+
+// OverwritePolicy specifies how to handle existing destination files.
+type OverwritePolicy int
+
+const (
+	// OverwriteAlways always overwrites existing destination files.
+	OverwriteAlways OverwritePolicy = iota
+	// OverwriteSkip never overwrites existing destination files and skips them.
+	OverwriteSkip
+	// OverwriteError never overwrites existing destination files and stops the copy with ErrDstExists.
+	OverwriteError
+	// OverwriteIfNewer overwrites the destination file only if src's modification time is after dst's.
+	OverwriteIfNewer
+	// OverwriteIfDifferent overwrites the destination file only if the size or the modification time differs.
+	// Set PreserveTimes to make the modification times comparable in the following copies.
+	OverwriteIfDifferent
+	// OverwriteBackup renames the existing destination file with a "~" suffix before writing.
+	OverwriteBackup
+	// OverwriteBackupNumbered renames the existing destination file with a numbered suffix(".~1~", ".~2~"...) before writing.
+	OverwriteBackupNumbered
+)
+
+// Outcome is the outcome of copying a file.
+type Outcome int
+
+const (
+	// OutcomeCreated means dst did not exist and it's created.
+	OutcomeCreated Outcome = iota
+	// OutcomeOverwritten means dst existed and it's overwritten.
+	OutcomeOverwritten
+	// OutcomeBackedUp means dst existed, it's backed up and a new one is created.
+	OutcomeBackedUp
+	// OutcomeSkipped means dst existed and it's skipped.
+	OutcomeSkipped
+	// OutcomeDeleted means dst is extraneous in a mirror copy and it's deleted or moved to the trash dir.
+	OutcomeDeleted
+)
+
+// String implements [fmt.Stringer] interface.
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeCreated:
+		return "created"
+	case OutcomeOverwritten:
+		return "overwritten"
+	case OutcomeBackedUp:
+		return "backed up"
+	case OutcomeSkipped:
+		return "skipped"
+	case OutcomeDeleted:
+		return "deleted"
+	default:
+		return "Outcome(" + strconv.Itoa(int(o)) + ")"
+	}
+}
+
+// FileResult contains the result of copying a file.
+type FileResult struct {
+	// Source file. It's empty if dst is deleted.
+	Src string
+	// Destination file.
+	Dst string
+	// Outcome of the copy. It's the planned outcome if Err is set.
+	Outcome Outcome
+	// Number of bytes written.
+	Bytes int64
+	// Time spent to copy the file.
+	Duration time.Duration
+	// Error of the copy. It's nil if the file is copied or skipped.
+	Err error
+	// Checksum of the file computed by the algorithm of Options.Verify.
+	// It's nil if the verification is disabled or the file is not copied.
+	// It's the only way to get the checksums of the files verified by the dir copies.
+	Digest []byte
+	// Checksums of the hashes created by Options.Hashes, or the hashes passed to [CopyFileWithHashes] and [CopyFSFileWithHashes].
+	// It's nil if no hashes are used or the file is not copied.
+	Sums [][]byte
+}
+
+// afterFile calls the AfterFile callback if it's set.
+func (opts *Options) afterFile(r *FileResult) {
+	if opts.AfterFile != nil {
+		opts.AfterFile(r)
+	}
+}
+
+// prepareDst checks the existing dst against the source file info according to the policy.
+// It backs up dst if required and returns the outcome of the copy.
+func prepareDst(dst string, fi fs.FileInfo, policy OverwritePolicy) (Outcome, error) {
+	outcome, err := checkDst(dst, fi, policy)
+	if err != nil || outcome != OutcomeBackedUp {
+		return outcome, err
+	}
+
+	backup := dst + "~"
+	if policy == OverwriteBackupNumbered {
+		if backup, err = nextNumberedBackup(dst); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.Rename(dst, backup); err != nil {
+		return 0, err
+	}
+	return OutcomeBackedUp, nil
+}
+
+// checkDst checks the existing dst against the source file info according to the policy
+// and returns the outcome of the copy without changing dst.
+func checkDst(dst string, fi fs.FileInfo, policy OverwritePolicy) (Outcome, error) {
+	dfi, err := os.Lstat(dst)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return OutcomeCreated, nil
+		}
+		return 0, err
+	}
+
+	// Dirs are never overwritten, let the following write fail.
+	if dfi.IsDir() {
+		return OutcomeOverwritten, nil
+	}
+
+	switch policy {
+	case OverwriteSkip:
+		return OutcomeSkipped, nil
+	case OverwriteError:
+		return 0, &fs.PathError{Op: "copy", Path: dst, Err: ErrDstExists}
+	case OverwriteIfNewer:
+		if !fi.ModTime().After(dfi.ModTime()) {
+			return OutcomeSkipped, nil
+		}
+	case OverwriteIfDifferent:
+		if fi.Size() == dfi.Size() && fi.ModTime().Equal(dfi.ModTime()) {
+			return OutcomeSkipped, nil
+		}
+	case OverwriteBackup, OverwriteBackupNumbered:
+		return OutcomeBackedUp, nil
+	}
+
+	return OutcomeOverwritten, nil
+}
+
+// nextNumberedBackup returns the next numbered backup name of dst like "file.~3~".
+func nextNumberedBackup(dst string) (string, error) {
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	if err != nil {
+		return "", err
+	}
+
+	prefix := filepath.Base(dst) + ".~"
+	max := 0
+
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, "~") {
+			continue
+		}
+
+		if i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, prefix), "~")); err == nil && i > max {
+			max = i
+		}
+	}
+
+	return fmt.Sprintf("%s.~%d~", dst, max+1), nil
+}
@@ -0,0 +1,191 @@
+package cp_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/northbright/cp"
+)
+
+func TestCopyFileOverwrite(t *testing.T) {
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	for _, tc := range []struct {
+		name   string
+		policy cp.OverwritePolicy
+		// Content of the existing dst. Leave it empty if dst does not exist.
+		dst string
+		// Modification time of dst relative to src.
+		age     time.Duration
+		outcome cp.Outcome
+		err     error
+		// Content of dst after the copy.
+		want string
+		// Backup files in the dir of dst after the copy.
+		backups map[string]string
+	}{
+		{"always", cp.OverwriteAlways, "old", 0, cp.OutcomeOverwritten, nil, "new!", nil},
+		{"always, no dst", cp.OverwriteAlways, "", 0, cp.OutcomeCreated, nil, "new!", nil},
+		{"skip", cp.OverwriteSkip, "old", 0, cp.OutcomeSkipped, nil, "old", nil},
+		{"skip, no dst", cp.OverwriteSkip, "", 0, cp.OutcomeCreated, nil, "new!", nil},
+		{"error", cp.OverwriteError, "old", 0, cp.OutcomeCreated, cp.ErrDstExists, "old", nil},
+		{"if newer, older dst", cp.OverwriteIfNewer, "old", -time.Minute, cp.OutcomeOverwritten, nil, "new!", nil},
+		{"if newer, newer dst", cp.OverwriteIfNewer, "old", time.Minute, cp.OutcomeSkipped, nil, "old", nil},
+		{"if newer, same time", cp.OverwriteIfNewer, "old", 0, cp.OutcomeSkipped, nil, "old", nil},
+		{"if different, same size and time", cp.OverwriteIfDifferent, "abcd", 0, cp.OutcomeSkipped, nil, "abcd", nil},
+		{"if different, size", cp.OverwriteIfDifferent, "old", 0, cp.OutcomeOverwritten, nil, "new!", nil},
+		{"if different, time", cp.OverwriteIfDifferent, "abcd", time.Minute, cp.OutcomeOverwritten, nil, "new!", nil},
+		{"backup", cp.OverwriteBackup, "old", 0, cp.OutcomeBackedUp, nil, "new!", map[string]string{"dst~": "old"}},
+		{"backup, no dst", cp.OverwriteBackup, "", 0, cp.OutcomeCreated, nil, "new!", nil},
+		{"backup numbered", cp.OverwriteBackupNumbered, "old", 0, cp.OutcomeBackedUp, nil, "new!", map[string]string{"dst.~1~": "old"}},
+	} {
+		dir := t.TempDir()
+		src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+		if err := os.WriteFile(src, []byte("new!"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(src, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+
+		if tc.dst != "" {
+			if err := os.WriteFile(dst, []byte(tc.dst), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(dst, mtime.Add(tc.age), mtime.Add(tc.age)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var res *cp.FileResult
+		opts := &cp.Options{
+			Overwrite: tc.policy,
+			AfterFile: func(r *cp.FileResult) { res = r },
+		}
+
+		_, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, opts)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%v: CopyFileWithOptions() error = %v, want %v", tc.name, err, tc.err)
+		}
+
+		if res == nil || res.Outcome != tc.outcome || !errors.Is(res.Err, tc.err) {
+			t.Errorf("%v: FileResult = %+v, want outcome %v, error %v", tc.name, res, tc.outcome, tc.err)
+		}
+
+		checkFiles(t, dir, map[string]string{"dst": tc.want}, nil)
+		checkFiles(t, dir, tc.backups, nil)
+
+		// No other files are created.
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2+len(tc.backups) {
+			t.Errorf("%v: %v files in the dir, want %v", tc.name, len(entries), 2+len(tc.backups))
+		}
+	}
+}
+
+func TestCopyFileBackupNumbered(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	writeFiles(t, dir, map[string]string{
+		"src":       "new",
+		"dst":       "old",
+		"dst.~1~":   "1",
+		"dst.~3~":   "3",
+		"dst.~x~":   "x",
+		"dst~":      "simple",
+		"other.~9~": "other",
+	})
+
+	opts := &cp.Options{Overwrite: cp.OverwriteBackupNumbered}
+
+	// The next number follows the largest one of dst.
+	if _, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, opts); err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	if _, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, opts); err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	checkFiles(t, dir, map[string]string{"dst": "new", "dst.~1~": "1", "dst.~3~": "3", "dst.~4~": "old", "dst.~5~": "new", "dst~": "simple"}, nil)
+
+	// The simple backup is replaced.
+	opts.Overwrite = cp.OverwriteBackup
+	if err := os.WriteFile(dst, []byte("latest"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, opts); err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	checkFiles(t, dir, map[string]string{"dst": "new", "dst~": "latest"}, nil)
+}
+
+func TestCopyDirOverwriteOutcomes(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"a.txt": "new a", "b.txt": "new b", "sub/c.txt": "new c"})
+
+	for _, tc := range []struct {
+		policy   cp.OverwritePolicy
+		outcomes map[string]cp.Outcome
+		files    map[string]string
+		n        int64
+	}{
+		{
+			cp.OverwriteSkip,
+			map[string]cp.Outcome{"a.txt": cp.OutcomeSkipped, "b.txt": cp.OutcomeCreated, "c.txt": cp.OutcomeSkipped},
+			map[string]string{"a.txt": "old a", "b.txt": "new b", "sub/c.txt": "old c"},
+			5,
+		},
+		{
+			cp.OverwriteBackup,
+			map[string]cp.Outcome{"a.txt": cp.OutcomeBackedUp, "b.txt": cp.OutcomeCreated, "c.txt": cp.OutcomeBackedUp},
+			map[string]string{"a.txt": "new a", "a.txt~": "old a", "b.txt": "new b", "sub/c.txt": "new c", "sub/c.txt~": "old c"},
+			15,
+		},
+	} {
+		for _, workers := range []int{0, 4} {
+			dst := filepath.Join(t.TempDir(), "dst")
+			writeFiles(t, dst, map[string]string{"a.txt": "old a", "sub/c.txt": "old c"})
+
+			// The callback is never called concurrently.
+			outcomes := map[string]cp.Outcome{}
+			opts := &cp.Options{
+				Overwrite: tc.policy,
+				Workers:   workers,
+				AfterFile: func(r *cp.FileResult) {
+					outcomes[filepath.Base(r.Src)] = r.Outcome
+				},
+			}
+
+			n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+			if err != nil {
+				t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+			}
+			if n != tc.n {
+				t.Errorf("workers %v: CopyDirWithOptions() = %v, want %v", workers, n, tc.n)
+			}
+
+			for name, want := range tc.outcomes {
+				if outcomes[name] != want {
+					t.Errorf("workers %v: outcome of %v = %v, want %v", workers, name, outcomes[name], want)
+				}
+			}
+			checkFiles(t, dst, tc.files, nil)
+		}
+	}
+
+	// The copy stops at the first existing file with OverwriteError.
+	dst := filepath.Join(t.TempDir(), "dst")
+	writeFiles(t, dst, map[string]string{"a.txt": "old a"})
+
+	_, err := cp.CopyDirWithOptions(context.Background(), src, dst, &cp.Options{Overwrite: cp.OverwriteError})
+	if !errors.Is(err, cp.ErrDstExists) {
+		t.Fatalf("CopyDirWithOptions() error = %v, want ErrDstExists", err)
+	}
+	checkFiles(t, dst, map[string]string{"a.txt": "old a"}, []string{"b.txt"})
+}
@@ -0,0 +1,183 @@
+package cp
+
+import (
+	"context"
+	"hash"
+	"io/fs"
+	"os"
+)
+
+// fileJob is a regular file to copy.
+type fileJob struct {
+	src string
+	// Slash-separated path of src relative to the source dir.
+	rel string
+	dst string
+	fi  fs.FileInfo
+	// Offset to resume the copy.
+	offset  int64
+	outcome Outcome
+	// Hashes created by Options.Hashes.
+	hashes []hash.Hash
+}
+
+// hardLinkJob is a hard link to create after the workers copied the target.
+type hardLinkJob struct {
+	src    string
+	rel    string
+	dst    string
+	target string
+	fi     fs.FileInfo
+}
+
+// startWorkers starts n workers to copy the regular files in parallel.
+// The first error of the workers cancels the others.
+func (c *dirCopier) startWorkers(n int) {
+	c.ctx, c.cancel = context.WithCancel(c.ctx)
+	c.jobs = make(chan fileJob)
+
+	for range n {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+
+			// The buffer can not be shared by the workers.
+			var buf []byte
+			if len(c.opts.Buf) > 0 {
+				buf = make([]byte, len(c.opts.Buf))
+			}
+
+			for job := range c.jobs {
+				if err := c.work(job, buf); err != nil {
+					c.fail(err)
+				}
+			}
+		}()
+	}
+}
+
+// dispatch sends the job to the workers.
+func (c *dirCopier) dispatch(job fileJob) error {
+	select {
+	case c.jobs <- job:
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+
+	// The offset of the file is not tracked while copying in parallel.
+	if c.ckpt != nil {
+		c.mu.Lock()
+		if c.ckpt.Current == job.rel {
+			c.ckpt.clearCurrent()
+		}
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// work copies the file of the job and aggregates the progress.
+// buf: buffer of the worker.
+func (c *dirCopier) work(job fileJob, buf []byte) error {
+	// Skip the remaining jobs after a worker failed.
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	// Count the bytes copied before resuming as done.
+	c.done += job.offset
+	c.mu.Unlock()
+
+	// Bytes written of the file reported last time.
+	var last int64
+
+	o := *c.opts
+	o.Buf = buf
+	o.OnWritten = func(total, prev, current int64, percent float32) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.inflight += current - last
+		last = current
+		reportProgress(c.opts.OnWritten, c.di.TotalSize, c.done, c.inflight)
+	}
+
+	// Report the progress of the file itself to get the last bytes written reported.
+	n, written, err := c.write(job, job.fi.Size(), job.offset, &o)
+
+	c.mu.Lock()
+	c.inflight -= last
+	c.done += n
+	c.copied += n
+	c.mu.Unlock()
+
+	if err != nil {
+		// Remove the partially written file to copy it again on resume.
+		// dst is kept if it's not changed, e.g. src can not be opened.
+		// The temporary file is removed already in the atomic mode.
+		if written && !c.opts.Atomic {
+			os.Remove(job.dst)
+		}
+		return err
+	}
+	return c.markDone(job.rel)
+}
+
+// fail records the first error of the workers and cancels the others.
+func (c *dirCopier) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		c.err = err
+		c.cancel()
+	}
+}
+
+// workerErr returns the first error of the workers.
+func (c *dirCopier) workerErr() error {
+	if c.jobs == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// wait waits for the workers to copy the dispatched files, then creates the hard links left.
+// walkErr: error of the walk.
+// It returns the first error of the workers which may cause the walk error.
+func (c *dirCopier) wait(walkErr error) error {
+	close(c.jobs)
+	c.wg.Wait()
+	c.cancel()
+
+	if c.err != nil {
+		return c.err
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+
+	for _, l := range c.links {
+		err := c.create(l.src, l.dst, l.fi, func() error {
+			return createHardLink(l.target, l.dst)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = c.markDone(l.rel); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range c.afterDirs {
+		if err := c.opts.afterDir(d[0], d[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
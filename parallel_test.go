@@ -0,0 +1,193 @@
+package cp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/northbright/cp"
+)
+
+// newParallelSrc creates a dir with files of different sizes in sub-dirs.
+// It returns the dir and the contents of the files by the relative paths.
+func newParallelSrc(t *testing.T) (string, map[string][]byte) {
+	t.Helper()
+
+	src := filepath.Join(t.TempDir(), "src")
+	files := map[string][]byte{}
+	for i := range 24 {
+		name := filepath.Join(fmt.Sprintf("d%d", i%3), fmt.Sprintf("f%02d.bin", i))
+		files[name] = bytes.Repeat([]byte{byte('a' + i)}, i*37*1024+i)
+	}
+
+	for name, content := range files {
+		p := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src, files
+}
+
+// progressRecorder records the progress reported by OnWritten and checks it.
+type progressRecorder struct {
+	t     *testing.T
+	total int64
+	last  int64
+	calls int
+}
+
+// onWritten checks that the total is the expected one and the progress never goes backwards.
+func (r *progressRecorder) onWritten(total, prev, current int64, percent float32) {
+	r.calls++
+	if total != r.total {
+		r.t.Errorf("OnWritten() total = %v, want %v", total, r.total)
+	}
+	if prev+current < r.last {
+		r.t.Errorf("OnWritten() progress goes backwards: %v after %v", prev+current, r.last)
+	}
+	if prev+current > total {
+		r.t.Errorf("OnWritten() progress %v exceeds total %v", prev+current, total)
+	}
+	r.last = prev + current
+}
+
+func TestCopyDirParallelProgress(t *testing.T) {
+	src, files := newParallelSrc(t)
+
+	di, err := cp.DirInfo(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{2, 8} {
+		dst := filepath.Join(t.TempDir(), "dst")
+		r := &progressRecorder{t: t, total: di.TotalSize}
+
+		opts := &cp.Options{
+			Workers:   workers,
+			Buf:       make([]byte, 4096),
+			FastPath:  cp.FastPathNever,
+			OnWritten: r.onWritten,
+		}
+
+		n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+		if err != nil {
+			t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+		}
+		if n != di.TotalSize || r.last != di.TotalSize {
+			t.Errorf("workers %v: CopyDirWithOptions() = %v, last progress %v, want %v", workers, n, r.last, di.TotalSize)
+		}
+
+		for name, content := range files {
+			if data, err := os.ReadFile(filepath.Join(dst, name)); err != nil || !bytes.Equal(data, content) {
+				t.Errorf("workers %v: content of %v differs: %v", workers, name, err)
+			}
+		}
+	}
+}
+
+func TestCopyDirParallelCancel(t *testing.T) {
+	src, files := newParallelSrc(t)
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop the copy after the first bytes are written.
+	opts := &cp.Options{
+		Workers:  4,
+		Buf:      make([]byte, 4096),
+		FastPath: cp.FastPathNever,
+		OnWritten: func(total, prev, current int64, percent float32) {
+			cancel()
+		},
+	}
+
+	start := time.Now()
+	_, err := cp.CopyDirWithOptions(ctx, src, dst, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CopyDirWithOptions() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("CopyDirWithOptions() stopped after %v", elapsed)
+	}
+
+	// The files left in dst are completed, the partially written ones are removed.
+	err = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if content, ok := files[rel]; !ok || !bytes.Equal(data, content) {
+			t.Errorf("partial file %v is left: %v bytes, want %v bytes", rel, len(data), len(content))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failOpenFS is a file system which fails to open the file.
+type failOpenFS struct {
+	fstest.MapFS
+	name string
+}
+
+// Open implements [fs.FS] interface.
+func (fsys failOpenFS) Open(name string) (fs.File, error) {
+	if name == fsys.name {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.MapFS.Open(name)
+}
+
+func TestCopyDirParallelKeepsDstOnOpenError(t *testing.T) {
+	fsys := failOpenFS{
+		MapFS: fstest.MapFS{
+			"src/a.txt": &fstest.MapFile{Data: []byte("new"), Mode: 0644},
+			"src/b.txt": &fstest.MapFile{Data: []byte("b"), Mode: 0644},
+		},
+		name: "src/a.txt",
+	}
+
+	for _, workers := range []int{0, 4} {
+		dst := filepath.Join(t.TempDir(), "dst")
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, "a.txt"), []byte("PRECIOUS"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := cp.CopyFSDirWithOptions(context.Background(), fsys, "src", dst, &cp.Options{Workers: workers})
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Fatalf("workers %v: CopyFSDirWithOptions() error = %v, want ErrPermission", workers, err)
+		}
+
+		// dst is not changed because src can not be opened.
+		if data, err := os.ReadFile(filepath.Join(dst, "a.txt")); err != nil || string(data) != "PRECIOUS" {
+			t.Errorf("workers %v: dst/a.txt = %q, %v, want %q", workers, data, err, "PRECIOUS")
+		}
+	}
+}
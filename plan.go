@@ -0,0 +1,404 @@
+package cp
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// EntryType is the type of an entry in a copy plan.
+type EntryType int
+
+const (
+	// EntryDir is a dir.
+	EntryDir EntryType = iota
+	// EntryFile is a regular file whose content is copied.
+	EntryFile
+	// EntrySymlink is a symlink which is not followed.
+	EntrySymlink
+	// EntryHardLink is a hard link to a file copied before. It's recreated when Options.HardLinks is set.
+	EntryHardLink
+	// EntrySpecial is a special file(named pipe, socket or device).
+	EntrySpecial
+)
+
+// String implements [fmt.Stringer] interface.
+func (t EntryType) String() string {
+	switch t {
+	case EntryDir:
+		return "dir"
+	case EntryFile:
+		return "file"
+	case EntrySymlink:
+		return "symlink"
+	case EntryHardLink:
+		return "hard link"
+	case EntrySpecial:
+		return "special file"
+	default:
+		return "EntryType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// PlanAction is the planned action of an entry in a copy plan.
+type PlanAction int
+
+const (
+	// PlanCreate means dst does not exist and it will be created.
+	PlanCreate PlanAction = iota
+	// PlanOverwrite means dst exists and it will be overwritten.
+	PlanOverwrite
+	// PlanBackup means dst exists, it will be backed up and a new one will be created.
+	PlanBackup
+	// PlanSkip means the entry will be skipped by Options.Compare, the overwrite policy, the BeforeFile callback,
+	// Options.Symlinks or Options.SpecialFiles.
+	PlanSkip
+	// PlanFilter means the entry is filtered out. A filtered dir is skipped with its contents.
+	PlanFilter
+	// PlanExists means the dst dir exists and it will be kept.
+	PlanExists
+	// PlanDelete means the entry of dst is extraneous and it will be deleted by Options.Delete.
+	PlanDelete
+	// PlanError means the entry can not be copied, e.g. dst exists with OverwriteError. PlanEntry.Err is the error.
+	// [Plan.Execute] fails if any entry has the action.
+	PlanError
+)
+
+// String implements [fmt.Stringer] interface.
+func (a PlanAction) String() string {
+	switch a {
+	case PlanCreate:
+		return "create"
+	case PlanOverwrite:
+		return "overwrite"
+	case PlanBackup:
+		return "backup"
+	case PlanSkip:
+		return "skip"
+	case PlanFilter:
+		return "filter"
+	case PlanExists:
+		return "exists"
+	case PlanDelete:
+		return "delete"
+	case PlanError:
+		return "error"
+	default:
+		return "PlanAction(" + strconv.Itoa(int(a)) + ")"
+	}
+}
+
+// planAction returns the planned action of the outcome.
+func planAction(o Outcome) PlanAction {
+	switch o {
+	case OutcomeOverwritten:
+		return PlanOverwrite
+	case OutcomeBackedUp:
+		return PlanBackup
+	case OutcomeSkipped:
+		return PlanSkip
+	default:
+		return PlanCreate
+	}
+}
+
+// PlanEntry is an entry of the source dir or an extraneous entry of dst to delete in a copy plan.
+type PlanEntry struct {
+	// Slash-separated path relative to the source dir. It's "." for the source dir.
+	// It's relative to dst for the entries to delete.
+	Path string
+	// Source file or dir. It's empty for the entries to delete.
+	Src string
+	// Destination file or dir. It may be changed by the BeforeFile callback.
+	Dst string
+	// Type of the entry.
+	Type EntryType
+	// Planned action of the entry.
+	Action PlanAction
+	// Number of bytes to copy. It's 0 unless the entry is a regular file to copy.
+	Size int64
+	// Error which makes the entry fail to copy. It's nil unless the action is PlanError.
+	Err error
+}
+
+// Plan is the plan of a dir copy returned by [PlanCopyDir] and [PlanCopyFSDir].
+type Plan struct {
+	// Source dir.
+	Src string
+	// Destination dir.
+	Dst string
+	// Entries of the source dir in the walk order.
+	// The entries to delete are placed before the other entries for DeleteBefore, or after them for DeleteAfter.
+	Entries []PlanEntry
+	// Number of the regular files to copy.
+	FileCount int64
+	// Number of the dirs to create.
+	DirCount int64
+	// Number of the files and dirs to delete.
+	DeleteCount int64
+	// Number of the entries which can not be copied.
+	ErrorCount int64
+	// Number of bytes to copy.
+	TotalSize int64
+
+	// Source of the copy.
+	s source
+	// Options of the copy.
+	opts *Options
+	// Dst paths to delete before copying.
+	deleted map[string]bool
+}
+
+// PlanCopyDir performs the walk and the policy decisions of [CopyDirWithOptions] without touching dst
+// and returns the plan which lists the dirs to create, the files to create, overwrite, skip or filter,
+// and the extraneous files and dirs of dst to delete if Options.Delete is set.
+// The entries which can not be copied, e.g. dst exists with OverwriteError, are planned with PlanError instead of failing the plan.
+// The BeforeFile callback is called to plan the skipped and renamed files.
+// Call [Plan.Execute] to execute the plan later.
+// src: source dir.
+// dst: destination dir.
+// opts: options of the copy. Leave it nil to use the default options.
+func PlanCopyDir(src, dst string, opts *Options) (*Plan, error) {
+	return planCopyDir(osSource{}, src, dst, opts)
+}
+
+// PlanCopyFSDir performs the walk and the policy decisions of [CopyFSDirWithOptions] without touching dst and returns the plan.
+// See [PlanCopyDir] for more information.
+func PlanCopyFSDir(fsys fs.FS, src, dst string, opts *Options) (*Plan, error) {
+	return planCopyDir(fsSource{fsys}, src, dst, opts)
+}
+
+// Execute executes the plan with the options passed to the plan function and returns the number of bytes copied.
+// Only the entries in the plan which are not filtered out are copied, and the entries created after planning are ignored.
+// The overwrite policy and the BeforeFile callback are applied again, so the outcomes may differ if dst was changed after planning.
+// It returns the error of the first entry with PlanError without touching dst.
+// ctx: context to stop the copy.
+func (p *Plan) Execute(ctx context.Context) (n int64, err error) {
+	opts := *p.opts
+	opts.planned = map[string]bool{}
+	for _, e := range p.Entries {
+		if e.Action == PlanError {
+			return 0, e.Err
+		}
+
+		if e.Action != PlanFilter {
+			opts.planned[e.Path] = true
+		}
+	}
+
+	return copyDir(ctx, p.s, p.Src, p.Dst, &opts, nil)
+}
+
+// planCopyDir returns the plan to copy src of the source to dst.
+func planCopyDir(s source, src, dst string, opts *Options) (*Plan, error) {
+	// Keep a copy of the options to execute the plan.
+	o := *opts.orDefault()
+	opts = &o
+
+	plan := &Plan{Src: src, Dst: dst, s: s, opts: opts, deleted: map[string]bool{}}
+	f := newFileFilter(s, opts)
+
+	// Files with multiple hard links planned.
+	linked := map[fileID]bool{}
+
+	// Dst files renamed by the BeforeFile callback.
+	renamed := map[string]bool{}
+
+	if opts.Delete == DeleteBefore {
+		if err := plan.planDelete(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	err := walk(s, src, opts.Symlinks == SymlinkFollow, func(p string, fi fs.FileInfo) error {
+		rel, err := s.rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		e := PlanEntry{Path: rel, Src: p, Dst: filepath.Join(dst, filepath.FromSlash(rel))}
+
+		// fi is a dir.
+		if fi.IsDir() {
+			e.Type = EntryDir
+
+			skip, err := f.walkDir(p, rel, fi)
+			if err != nil {
+				return err
+			}
+
+			if skip {
+				e.Action = PlanFilter
+				plan.Entries = append(plan.Entries, e)
+				return fs.SkipDir
+			}
+
+			if dfi, err := os.Stat(e.Dst); err == nil && dfi.IsDir() && !plan.deleted[e.Dst] {
+				e.Action = PlanExists
+			} else {
+				e.Action = PlanCreate
+				plan.DirCount += 1
+			}
+			plan.Entries = append(plan.Entries, e)
+			return nil
+		}
+
+		if err := plan.planFile(&e, f, linked, fi); err != nil {
+			return err
+		}
+
+		if dst := filepath.Join(dst, filepath.FromSlash(rel)); e.Dst != dst {
+			renamed[filepath.Clean(e.Dst)] = true
+		}
+		plan.Entries = append(plan.Entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Delete == DeleteAfter {
+		if err := plan.planDelete(renamed); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// planDelete plans to delete the extraneous entries of dst.
+// keep: dst paths to keep. It's optional.
+func (plan *Plan) planDelete(keep map[string]bool) error {
+	entries, err := findExtraneous(plan.s, plan.Src, plan.Dst, plan.opts, keep)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		t := EntryFile
+		switch {
+		case e.fi.IsDir():
+			t = EntryDir
+		case isSymlink(e.fi):
+			t = EntrySymlink
+		case isSpecial(e.fi):
+			t = EntrySpecial
+		}
+
+		plan.Entries = append(plan.Entries, PlanEntry{Path: e.rel, Dst: e.p, Type: t, Action: PlanDelete})
+		plan.DeleteCount += 1
+		plan.deleted[e.p] = true
+	}
+	return nil
+}
+
+// planFile plans the file, symlink or special file of the entry.
+// linked: files with multiple hard links planned.
+func (plan *Plan) planFile(e *PlanEntry, f *fileFilter, linked map[fileID]bool, fi fs.FileInfo) error {
+	opts := plan.opts
+
+	switch {
+	case isSymlink(fi):
+		e.Type = EntrySymlink
+	case isSpecial(fi):
+		e.Type = EntrySpecial
+	default:
+		e.Type = EntryFile
+	}
+
+	ok, err := f.matchFile(e.Src, e.Path, fi)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		e.Action = PlanFilter
+		return nil
+	}
+
+	// Skip the unchanged file before calling BeforeFile.
+	if e.Type == EntryFile {
+		id, ok := hardLinkID(fi)
+		if !ok || !opts.HardLinks || !linked[id] {
+			same, err := unchanged(context.Background(), plan.s, e.Src, e.Dst, fi, opts)
+			if err != nil {
+				return err
+			}
+
+			if same {
+				if ok && opts.HardLinks {
+					linked[id] = true
+				}
+				e.Action = PlanSkip
+				return nil
+			}
+		}
+	}
+
+	// Let the callback skip the file or change the destination.
+	if opts.BeforeFile != nil {
+		op := &FileOp{Src: e.Src, Dst: e.Dst, Info: fi}
+		if err := opts.beforeFile(op); err != nil {
+			return err
+		}
+
+		if op.Skip {
+			e.Action = PlanSkip
+			return nil
+		}
+		e.Dst = op.Dst
+	}
+
+	switch e.Type {
+	case EntrySymlink:
+		if opts.Symlinks != SymlinkPreserve {
+			e.Action = PlanSkip
+			return nil
+		}
+	case EntrySpecial:
+		switch opts.SpecialFiles {
+		case SpecialFileRecreate:
+		case SpecialFileError:
+			plan.planError(e, specialFileError(e.Src))
+			return nil
+		default:
+			e.Action = PlanSkip
+			return nil
+		}
+	case EntryFile:
+		if opts.HardLinks {
+			if id, ok := hardLinkID(fi); ok {
+				if linked[id] {
+					e.Type = EntryHardLink
+				}
+				linked[id] = true
+			}
+		}
+	}
+
+	// dst deleted before copying will be created.
+	e.Action = PlanCreate
+	if !plan.deleted[e.Dst] {
+		outcome, err := checkDst(e.Dst, fi, opts.Overwrite)
+		if err != nil {
+			plan.planError(e, err)
+			return nil
+		}
+		e.Action = planAction(outcome)
+	}
+
+	if e.Type == EntryFile && e.Action != PlanSkip {
+		e.Size = fi.Size()
+		plan.FileCount += 1
+		plan.TotalSize += e.Size
+	}
+	return nil
+}
+
+// planError records the error of the entry which can not be copied.
+func (plan *Plan) planError(e *PlanEntry, err error) {
+	e.Action, e.Err = PlanError, err
+	plan.ErrorCount += 1
+}
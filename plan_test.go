@@ -0,0 +1,129 @@
+package cp_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/northbright/cp"
+)
+
+func TestPlanCopyDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{
+		"a.txt":     "hello",
+		"c.txt":     "new",
+		"debug.log": "log",
+		"sub/b.txt": "world!",
+	})
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	writeFiles(t, dst, map[string]string{
+		"c.txt":   "old",
+		"old.txt": "old",
+		"sub/":    "",
+	})
+
+	opts := &cp.Options{
+		Exclude:   []cp.Rule{{Glob: "*.log"}},
+		Overwrite: cp.OverwriteSkip,
+		Delete:    cp.DeleteAfter,
+	}
+
+	plan, err := cp.PlanCopyDir(src, dst, opts)
+	if err != nil {
+		t.Fatalf("PlanCopyDir() error: %v", err)
+	}
+
+	want := []struct {
+		path   string
+		typ    cp.EntryType
+		action cp.PlanAction
+		size   int64
+	}{
+		{".", cp.EntryDir, cp.PlanExists, 0},
+		{"a.txt", cp.EntryFile, cp.PlanCreate, 5},
+		{"c.txt", cp.EntryFile, cp.PlanSkip, 0},
+		{"debug.log", cp.EntryFile, cp.PlanFilter, 0},
+		{"sub", cp.EntryDir, cp.PlanExists, 0},
+		{"sub/b.txt", cp.EntryFile, cp.PlanCreate, 6},
+		{"old.txt", cp.EntryFile, cp.PlanDelete, 0},
+	}
+	if len(plan.Entries) != len(want) {
+		t.Fatalf("PlanCopyDir() returns %v entries, want %v: %+v", len(plan.Entries), len(want), plan.Entries)
+	}
+	for i, w := range want {
+		e := plan.Entries[i]
+		if e.Path != w.path || e.Type != w.typ || e.Action != w.action || e.Size != w.size {
+			t.Errorf("entry %v = %v %v %v %v, want %v %v %v %v", i, e.Path, e.Type, e.Action, e.Size, w.path, w.typ, w.action, w.size)
+		}
+	}
+	if plan.FileCount != 2 || plan.DirCount != 0 || plan.DeleteCount != 1 || plan.ErrorCount != 0 || plan.TotalSize != 11 {
+		t.Errorf("PlanCopyDir() = FileCount %v, DirCount %v, DeleteCount %v, ErrorCount %v, TotalSize %v, want 2, 0, 1, 0, 11",
+			plan.FileCount, plan.DirCount, plan.DeleteCount, plan.ErrorCount, plan.TotalSize)
+	}
+
+	// dst is not touched by planning.
+	checkFiles(t, dst, map[string]string{"c.txt": "old", "old.txt": "old"}, []string{"a.txt", "sub/b.txt"})
+
+	n, err := plan.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if n != plan.TotalSize {
+		t.Errorf("Execute() = %v, want %v", n, plan.TotalSize)
+	}
+	checkFiles(t, dst, map[string]string{"a.txt": "hello", "c.txt": "old", "sub/b.txt": "world!"}, []string{"debug.log", "old.txt"})
+}
+
+func TestPlanExecuteOnlyPlannedEntries(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"a.txt": "a"})
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	writeFiles(t, dst, map[string]string{"old.txt": "old"})
+
+	plan, err := cp.PlanCopyDir(src, dst, &cp.Options{Delete: cp.DeleteAfter})
+	if err != nil {
+		t.Fatalf("PlanCopyDir() error: %v", err)
+	}
+
+	// The entries created after planning are ignored.
+	writeFiles(t, src, map[string]string{"new.txt": "new", "new/b.txt": "b"})
+	writeFiles(t, dst, map[string]string{"later.txt": "later"})
+
+	if _, err = plan.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	checkFiles(t, dst, map[string]string{"a.txt": "a", "later.txt": "later"}, []string{"old.txt", "new.txt", "new"})
+}
+
+func TestPlanCopyDirOverwriteError(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"a.txt": "new", "b.txt": "b"})
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	writeFiles(t, dst, map[string]string{"a.txt": "old"})
+
+	plan, err := cp.PlanCopyDir(src, dst, &cp.Options{Overwrite: cp.OverwriteError})
+	if err != nil {
+		t.Fatalf("PlanCopyDir() error: %v", err)
+	}
+
+	// The conflict is recorded in the plan.
+	if plan.ErrorCount != 1 || plan.FileCount != 1 {
+		t.Errorf("PlanCopyDir() = ErrorCount %v, FileCount %v, want 1, 1", plan.ErrorCount, plan.FileCount)
+	}
+	for _, e := range plan.Entries {
+		if e.Path == "a.txt" && (e.Action != cp.PlanError || !errors.Is(e.Err, cp.ErrDstExists)) {
+			t.Errorf("entry a.txt = %v, %v, want %v, ErrDstExists", e.Action, e.Err, cp.PlanError)
+		}
+	}
+
+	// Execute fails without touching dst.
+	if _, err = plan.Execute(context.Background()); !errors.Is(err, cp.ErrDstExists) {
+		t.Fatalf("Execute() error = %v, want ErrDstExists", err)
+	}
+	checkFiles(t, dst, map[string]string{"a.txt": "old"}, []string{"b.txt"})
+}
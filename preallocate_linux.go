@@ -0,0 +1,20 @@
+package cp
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate allocates the disk space of f for size bytes and sets the size of f.
+// It falls back to truncate f if fallocate is not supported by the file system.
+func preallocate(f *os.File, size int64) error {
+	if size <= 0 {
+		return f.Truncate(size)
+	}
+
+	if err := unix.Fallocate(int(f.Fd()), 0, 0, size); err == nil {
+		return nil
+	}
+	return f.Truncate(size)
+}
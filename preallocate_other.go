@@ -0,0 +1,13 @@
+//go:build !linux
+
+package cp
+
+import (
+	"os"
+)
+
+// preallocate sets the size of f.
+// The disk space is not allocated in advance on this platform.
+func preallocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
@@ -0,0 +1,79 @@
+package cp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// PreserveFlags specifies the file attributes to preserve, like "cp -a".
+type PreserveFlags int
+
+const (
+	// PreserveMode preserves the permission bits(and setuid, setgid, sticky bits).
+	PreserveMode PreserveFlags = 1 << iota
+	// PreserveTimes preserves the access and modification times with nanosecond precision when available.
+	PreserveTimes
+	// PreserveOwner preserves the uid and gid when permitted.
+	// It's ignored if the current user has no permission to change the ownership.
+	PreserveOwner
+
+	// PreserveAll preserves mode, times and ownership.
+	PreserveAll = PreserveMode | PreserveTimes | PreserveOwner
+)
+
+// preserveAttrs applies the attributes of the source file info to dst according to flags.
+// For directories, it should be called after the contents are written,
+// or the dir's mode and mtime would be changed by the following writes.
+func preserveAttrs(dst string, fi fs.FileInfo, flags PreserveFlags) error {
+	if flags == 0 {
+		return nil
+	}
+
+	// Change ownership first, chown may clear setuid and setgid bits.
+	if flags&PreserveOwner != 0 {
+		if uid, gid, ok := fileOwner(fi); ok {
+			if err := os.Lchown(dst, uid, gid); err != nil && !errors.Is(err, fs.ErrPermission) {
+				return err
+			}
+		}
+	}
+
+	// Symlinks have no mode on most platforms and os.Chtimes follows the link.
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		return nil
+	}
+
+	if flags&PreserveMode != 0 {
+		if err := os.Chmod(dst, fi.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+			return err
+		}
+	}
+
+	if flags&PreserveTimes != 0 {
+		// The zero time(e.g. files in embed.FS) leaves the time unchanged.
+		if err := os.Chtimes(dst, fileAtime(fi), fi.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dirAttrs records a destination dir and its source file info
+// to preserve the attributes after the contents are written.
+type dirAttrs struct {
+	dst string
+	fi  fs.FileInfo
+}
+
+// preserveDirAttrs applies the attributes of the dirs in reverse order,
+// so that sub-dirs are done before their parents.
+func preserveDirAttrs(dirs []dirAttrs, flags PreserveFlags) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := preserveAttrs(dirs[i].dst, dirs[i].fi, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
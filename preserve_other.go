@@ -0,0 +1,13 @@
+//go:build !unix
+
+package cp
+
+import (
+	"io/fs"
+)
+
+// fileOwner returns the uid and gid of the file info.
+// Ownership is not supported on this platform.
+func fileOwner(fi fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,105 @@
+//go:build unix
+
+package cp_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/northbright/cp"
+)
+
+func TestCopyDirPreserveDirAttrs(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"ro/a.txt": "hello", "ro/sub/b.txt": "world!"})
+
+	// The dirs are older than their children, and ro can not be written after it's created.
+	old := time.Date(2001, 2, 3, 4, 5, 6, 789, time.UTC)
+	dirs := map[string]fs.FileMode{"ro/sub": 0750, "ro": 0500}
+	for _, name := range []string{"ro/sub", "ro"} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, dirs[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	// Make the dirs writable to remove them.
+	t.Cleanup(func() {
+		for _, dir := range []string{src, dst} {
+			os.Chmod(filepath.Join(dir, "ro"), 0755)
+		}
+	})
+
+	for _, workers := range []int{0, 4} {
+		// Remove dst of the previous copy.
+		os.Chmod(filepath.Join(dst, "ro"), 0755)
+		os.RemoveAll(dst)
+
+		opts := &cp.Options{Preserve: cp.PreserveMode | cp.PreserveTimes, Workers: workers}
+		if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts); err != nil {
+			t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+		}
+
+		// The attributes of the dirs are applied after their contents are written.
+		for name, mode := range dirs {
+			fi, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != mode {
+				t.Errorf("workers %v: mode of dst/%v = %v, want %v", workers, name, fi.Mode().Perm(), mode)
+			}
+			if !fi.ModTime().Equal(old) {
+				t.Errorf("workers %v: mtime of dst/%v = %v, want %v", workers, name, fi.ModTime(), old)
+			}
+		}
+		checkFiles(t, dst, map[string]string{"ro/a.txt": "hello", "ro/sub/b.txt": "world!"}, nil)
+	}
+}
+
+func TestCopyFilePreserveTimes(t *testing.T) {
+	content := []byte("hello, world!")
+	src, dst := newResumeFiles(t, content, nil)
+
+	mtime := time.Unix(1700000000, 123456789)
+	atime := time.Unix(1600000000, 987654321)
+	if err := os.Chtimes(src, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0604); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, &cp.Options{Preserve: cp.PreserveAll}); err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The nanoseconds are kept.
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("mtime of dst = %v, want %v", fi.ModTime(), mtime)
+	}
+	if fi.Mode().Perm() != 0604 {
+		t.Errorf("mode of dst = %v, want %v", fi.Mode().Perm(), fs.FileMode(0604))
+	}
+
+	// The times are not preserved without PreserveTimes.
+	if _, err = cp.CopyFileWithOptions(context.Background(), src, dst, 0, nil); err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	if fi, err = os.Stat(dst); err != nil || fi.ModTime().Equal(mtime) {
+		t.Errorf("mtime of dst = %v, %v, want the time of the copy", fi.ModTime(), err)
+	}
+}
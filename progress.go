@@ -0,0 +1,211 @@
+package cp
+
+import (
+	"context"
+	"time"
+
+	"github.com/northbright/iocopy"
+)
+
+// computePercent returns the percentage like iocopy does.
+func computePercent(total, prev, current int64) float32 {
+	if total == 0 {
+		return 100
+	}
+
+	if total < 0 || prev+current < 0 {
+		return 0
+	}
+
+	return float32(float64(prev+current) / (float64(total) / float64(100)))
+}
+
+// reportProgress calls fn if it's not nil.
+// It's used to report the progress of the bytes not copied by iocopy.
+func reportProgress(fn iocopy.OnWrittenFunc, total, prev, current int64) {
+	if fn != nil {
+		fn(total, prev, current, computePercent(total, prev, current))
+	}
+}
+
+const (
+	// Default minimum interval between progress events.
+	DefaultProgressInterval = 500 * time.Millisecond
+	// Default maximum time to wait for the final progress event to be received from a full channel.
+	DefaultFinalProgressTimeout = time.Second
+)
+
+// rateSmoothing is the weight of the latest rate sample in the exponential moving average.
+const rateSmoothing = 0.3
+
+// Progress is a progress event of dir copies.
+type Progress struct {
+	// Source file being copied. It's the latest started one while copying files in parallel,
+	// and it's empty in the final event.
+	Path string
+	// Index of the file being copied starting from 1.
+	FileIndex int64
+	// Number of files to copy. It's DirInfoData.FileCount.
+	FileCount int64
+	// Number of bytes done, including the skipped files.
+	Done int64
+	// Total size of the files to copy. It's DirInfoData.TotalSize.
+	Total int64
+	// Percentage of the bytes done.
+	Percent float32
+	// Smoothed rate in bytes per second.
+	Rate float64
+	// Elapsed time since the copy started.
+	Elapsed time.Duration
+	// Estimated remaining time. It's 0 if the rate is unknown.
+	ETA time.Duration
+}
+
+// progressTracker computes the progress events and delivers them to the callback and the channel.
+// It's not safe for concurrent use.
+type progressTracker struct {
+	fn       func(p Progress)
+	ch       chan<- Progress
+	interval time.Duration
+	// Maximum time to wait for the final event to be received. It's negative to never wait.
+	finalTimeout time.Duration
+	p            Progress
+	start        time.Time
+	// Time of the last event delivered.
+	last time.Time
+	// Time and bytes done of the last rate sample.
+	sampled     time.Time
+	sampledDone int64
+}
+
+// newProgressTracker returns a tracker of the dir copy.
+// It returns nil if neither Options.OnProgress nor Options.ProgressChan is set.
+func newProgressTracker(di *DirInfoData, opts *Options) *progressTracker {
+	if opts.OnProgress == nil && opts.ProgressChan == nil {
+		return nil
+	}
+
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+
+	finalTimeout := opts.FinalProgressTimeout
+	if finalTimeout == 0 {
+		finalTimeout = DefaultFinalProgressTimeout
+	}
+
+	now := time.Now()
+	return &progressTracker{
+		fn:           opts.OnProgress,
+		ch:           opts.ProgressChan,
+		interval:     interval,
+		finalTimeout: finalTimeout,
+		p:            Progress{FileCount: di.FileCount, Total: di.TotalSize},
+		start:        now,
+		sampled:      now,
+	}
+}
+
+// onWritten returns the callback to update the bytes done, which also calls fn.
+func (t *progressTracker) onWritten(fn iocopy.OnWrittenFunc) iocopy.OnWrittenFunc {
+	return func(total, prev, current int64, percent float32) {
+		t.p.Done = prev + current
+		t.emit(false)
+
+		if fn != nil {
+			fn(total, prev, current, percent)
+		}
+	}
+}
+
+// startFile records the file started to copy.
+func (t *progressTracker) startFile(p string) {
+	t.p.Path = p
+	t.p.FileIndex += 1
+	t.emit(false)
+}
+
+// addFile counts the file which is not counted in the total.
+func (t *progressTracker) addFile(size int64) {
+	t.p.FileCount += 1
+	t.p.Total += size
+}
+
+// finish delivers the final event.
+// If the channel is full, it waits until the event is received, the final timeout expires or ctx is done.
+func (t *progressTracker) finish(ctx context.Context) {
+	t.p.Path = ""
+	t.update(time.Now())
+
+	if t.fn != nil {
+		t.fn(t.p)
+	}
+
+	if t.ch == nil {
+		return
+	}
+
+	select {
+	case t.ch <- t.p:
+		return
+	default:
+	}
+
+	if t.finalTimeout < 0 {
+		return
+	}
+
+	timer := time.NewTimer(t.finalTimeout)
+	defer timer.Stop()
+
+	select {
+	case t.ch <- t.p:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// emit delivers the event if the interval elapsed since the last one or force is set.
+// The event is dropped if the channel is full.
+func (t *progressTracker) emit(force bool) {
+	now := time.Now()
+	if !force && !t.last.IsZero() && now.Sub(t.last) < t.interval {
+		return
+	}
+	t.update(now)
+
+	if t.fn != nil {
+		t.fn(t.p)
+	}
+
+	if t.ch != nil {
+		select {
+		case t.ch <- t.p:
+		default:
+		}
+	}
+}
+
+// update updates the rate, percentage, elapsed time and ETA of the event delivered at now.
+func (t *progressTracker) update(now time.Time) {
+	t.last = now
+
+	// Update the smoothed rate.
+	if dt := now.Sub(t.sampled).Seconds(); dt > 0 {
+		rate := float64(t.p.Done-t.sampledDone) / dt
+		if t.p.Rate == 0 {
+			t.p.Rate = rate
+		} else {
+			t.p.Rate = rateSmoothing*rate + (1-rateSmoothing)*t.p.Rate
+		}
+		t.sampled, t.sampledDone = now, t.p.Done
+	}
+
+	t.p.Percent = computePercent(t.p.Total, t.p.Done, 0)
+	t.p.Elapsed = now.Sub(t.start)
+	t.p.ETA = 0
+	if t.p.Rate > 0 && t.p.Total > t.p.Done {
+		t.p.ETA = time.Duration(float64(t.p.Total-t.p.Done) / t.p.Rate * float64(time.Second))
+	}
+}
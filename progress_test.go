@@ -0,0 +1,119 @@
+package cp_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/northbright/cp"
+)
+
+func TestProgressChanFinalEvent(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte("hello"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The channel is full before the copy starts.
+	ch := make(chan cp.Progress, 1)
+	ch <- cp.Progress{}
+
+	done := make(chan error, 1)
+	go func() {
+		opts := &cp.Options{ProgressChan: ch, FinalProgressTimeout: 10 * time.Second}
+		_, err := cp.CopyDirWithOptions(context.Background(), src, filepath.Join(t.TempDir(), "dst"), opts)
+		done <- err
+	}()
+
+	// The copy waits for the final event to be received.
+	select {
+	case err := <-done:
+		t.Fatalf("CopyDirWithOptions() returned before the final event is received: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	<-ch
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case p := <-ch:
+			if p.Path != "" || p.Done != p.Total {
+				continue
+			}
+			if p.Total != 15 || p.FileCount != 3 || p.Percent != 100 {
+				t.Errorf("final event = %+v, want Total 15, FileCount 3, Percent 100", p)
+			}
+
+			if err := <-done; err != nil {
+				t.Fatalf("CopyDirWithOptions() error: %v", err)
+			}
+			return
+		case <-timeout:
+			t.Fatal("the final event is not delivered")
+		}
+	}
+}
+
+func TestProgressChanFinalEventCanceled(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody receives the final event.
+	ch := make(chan cp.Progress)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		opts := &cp.Options{ProgressChan: ch, FinalProgressTimeout: time.Hour}
+		_, err := cp.CopyDirWithOptions(ctx, src, filepath.Join(t.TempDir(), "dst"), opts)
+		done <- err
+	}()
+
+	// The blocked final event is abandoned after ctx is done.
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("CopyDirWithOptions() is blocked by the final event after ctx is done")
+	}
+}
+
+func TestProgressChanFinalEventTimeout(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, timeout := range []time.Duration{0, 50 * time.Millisecond, -1} {
+		// The channel is read after the copy returns.
+		ch := make(chan cp.Progress)
+
+		start := time.Now()
+		opts := &cp.Options{ProgressChan: ch, FinalProgressTimeout: timeout}
+		if _, err := cp.CopyDirWithOptions(context.Background(), src, filepath.Join(t.TempDir(), "dst"), opts); err != nil {
+			t.Fatalf("timeout %v: CopyDirWithOptions() error: %v", timeout, err)
+		}
+
+		// The final event is abandoned after the timeout.
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("timeout %v: CopyDirWithOptions() returned after %v", timeout, elapsed)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/northbright/iocopy"
+)
+
+var (
+	// ErrResumeMismatch represents the error that the destination file does not match the source to resume the copy.
+	// It's wrapped in a [fs.PathError] which contains the path of the file.
+	ErrResumeMismatch = errors.New("resume mismatch")
+)
+
+// ResumeCheck specifies how to check the destination file before resuming a copy.
+type ResumeCheck int
+
+const (
+	// ResumeCheckNone trusts the first copied bytes of the destination file.
+	ResumeCheckNone ResumeCheck = iota
+	// ResumeCheckSize checks if the size of the destination file is at least the number of bytes copied previously.
+	// Dir copies resumed from a checkpoint also check the size and the modification time of the source file recorded in the checkpoint.
+	ResumeCheckSize
+	// ResumeCheckHash checks the same as ResumeCheckSize,
+	// and compares the SHA-256 checksums of the first copied bytes of the source and destination files.
+	ResumeCheckHash
+)
+
+// resumeMismatchError returns the error that the file p does not match to resume the copy.
+func resumeMismatchError(p string) error {
+	return &fs.PathError{Op: "resume", Path: p, Err: ErrResumeMismatch}
+}
+
+// checkResumeSize checks if the size of dst is at least offset.
+// A missing dst does not match.
+func checkResumeSize(dst string, offset int64) error {
+	fi, err := os.Stat(dst)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return resumeMismatchError(dst)
+		}
+		return err
+	}
+
+	if fi.Size() < offset {
+		return resumeMismatchError(dst)
+	}
+	return nil
+}
+
+// verifyPrefix compares the SHA-256 checksums of the first offset bytes of src and dst.
+// src is read to offset after it returns.
+// w: writer to receive the bytes of src read. Leave it nil to discard the bytes.
+func verifyPrefix(ctx context.Context, src fs.File, dst string, offset int64, buf []byte, w io.Writer) error {
+	r := io.Reader(src)
+	if w != nil {
+		r = io.TeeReader(src, w)
+	}
+
+	sumSrc, err := prefixSum(ctx, r, offset, buf)
+	if err != nil {
+		return err
+	}
+
+	fDst, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer fDst.Close()
+
+	sumDst, err := prefixSum(ctx, fDst, offset, buf)
+	if err != nil {
+		return err
+	}
+
+	if sumSrc == nil || sumDst == nil || !bytes.Equal(sumSrc, sumDst) {
+		return resumeMismatchError(dst)
+	}
+	return nil
+}
+
+// prefixSum returns the SHA-256 checksum of the first n bytes of r.
+// It returns nil if r has less than n bytes.
+func prefixSum(ctx context.Context, r io.Reader, n int64, buf []byte) ([]byte, error) {
+	h := sha256.New()
+
+	written, err := iocopy.CopyBuffer(ctx, h, io.LimitReader(r, n), buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if written < n {
+		return nil, nil
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,254 @@
+package cp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/northbright/cp"
+)
+
+// checkResumeMismatch checks that err is a [fs.PathError] of the path wrapping ErrResumeMismatch.
+func checkResumeMismatch(t *testing.T, err error, path string) {
+	t.Helper()
+
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || !errors.Is(err, cp.ErrResumeMismatch) {
+		t.Fatalf("error = %v, want *fs.PathError wrapping ErrResumeMismatch", err)
+	}
+	if pathErr.Path != path {
+		t.Errorf("PathError.Path = %v, want %v", pathErr.Path, path)
+	}
+}
+
+// newResumeFiles creates src with the content and dst with the prefix.
+func newResumeFiles(t *testing.T, content, prefix []byte) (src, dst string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	src, dst = filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, prefix, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return src, dst
+}
+
+func TestResumeCheckSize(t *testing.T) {
+	content := []byte("hello, world!")
+
+	// dst is shorter than the bytes copied previously.
+	src, dst := newResumeFiles(t, content, content[:3])
+	_, err := cp.CopyFileWithOptions(context.Background(), src, dst, 5, &cp.Options{ResumeCheck: cp.ResumeCheckSize})
+	checkResumeMismatch(t, err, dst)
+
+	// dst is kept for the next attempt.
+	if data, err := os.ReadFile(dst); err != nil || !bytes.Equal(data, content[:3]) {
+		t.Errorf("dst = %q, %v, want %q", data, err, content[:3])
+	}
+
+	// The size is not checked without ResumeCheck.
+	n, err := cp.CopyFileWithOptions(context.Background(), src, dst, 5, nil)
+	if err != nil || n != int64(len(content))-5 {
+		t.Errorf("CopyFileWithOptions() = %v, %v, want %v, nil", n, err, len(content)-5)
+	}
+}
+
+func TestResumeCheckMissingDst(t *testing.T) {
+	content := []byte("hello, world!")
+
+	for _, check := range []cp.ResumeCheck{cp.ResumeCheckSize, cp.ResumeCheckHash} {
+		src, dst := newResumeFiles(t, content, nil)
+		if err := os.Remove(dst); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := cp.CopyFileWithOptions(context.Background(), src, dst, 5, &cp.Options{ResumeCheck: check})
+		checkResumeMismatch(t, err, dst)
+
+		// No empty dst is left.
+		if _, err = os.Stat(dst); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%v: Stat(dst) error = %v, want ErrNotExist", check, err)
+		}
+	}
+}
+
+func TestResumeCheckHash(t *testing.T) {
+	content := []byte("hello, world!")
+	opts := &cp.Options{ResumeCheck: cp.ResumeCheckHash}
+
+	// The prefix of dst is tampered.
+	src, dst := newResumeFiles(t, content, []byte("HELLO"))
+	_, err := cp.CopyFileWithOptions(context.Background(), src, dst, 5, opts)
+	checkResumeMismatch(t, err, dst)
+
+	// The prefix of dst matches.
+	src, dst = newResumeFiles(t, content, content[:5])
+	n, err := cp.CopyFileWithOptions(context.Background(), src, dst, 5, opts)
+	if err != nil || n != int64(len(content))-5 {
+		t.Fatalf("CopyFileWithOptions() = %v, %v, want %v, nil", n, err, len(content)-5)
+	}
+	if data, err := os.ReadFile(dst); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("dst = %q, %v, want %q", data, err, content)
+	}
+}
+
+func TestResumeTruncatesLongerDst(t *testing.T) {
+	content := []byte("hello, world!")
+
+	// dst has stale bytes after the end of src.
+	for _, check := range []cp.ResumeCheck{cp.ResumeCheckNone, cp.ResumeCheckSize, cp.ResumeCheckHash} {
+		src, dst := newResumeFiles(t, content, []byte("hello, world! and stale bytes"))
+		n, err := cp.CopyFileWithOptions(context.Background(), src, dst, 5, &cp.Options{ResumeCheck: check})
+		if err != nil || n != int64(len(content))-5 {
+			t.Fatalf("ResumeCheck %v: CopyFileWithOptions() = %v, %v, want %v, nil", check, n, err, len(content)-5)
+		}
+		if data, err := os.ReadFile(dst); err != nil || !bytes.Equal(data, content) {
+			t.Errorf("ResumeCheck %v: dst = %q, %v, want %q", check, data, err, content)
+		}
+	}
+}
+
+// stopDirCopy stops the copy of a dir in the middle of a file and returns the src, dst and the options to resume the copy.
+func stopDirCopy(t *testing.T) (src, dst string, content []byte, opts *cp.Options) {
+	t.Helper()
+
+	dir := t.TempDir()
+	src, dst = filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	content = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opts = &cp.Options{
+		Checkpoint:  filepath.Join(dir, "checkpoint.json"),
+		ResumeCheck: cp.ResumeCheckSize,
+		FastPath:    cp.FastPathNever,
+		Buf:         make([]byte, 4096),
+		// Stop the copy after the first write.
+		OnWritten: func(total, prev, current int64, percent float32) {
+			cancel()
+		},
+	}
+
+	if _, err := cp.CopyDirWithOptions(ctx, src, dst, opts); !errors.Is(err, context.Canceled) {
+		t.Fatalf("CopyDirWithOptions() error = %v, want context.Canceled", err)
+	}
+
+	ckpt, err := cp.LoadCheckpoint(opts.Checkpoint)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint() error: %v", err)
+	}
+	if ckpt.Current != "a.bin" || ckpt.Offset == 0 || ckpt.Offset >= int64(len(content)) {
+		t.Fatalf("checkpoint = %+v, want a partially copied a.bin", ckpt)
+	}
+
+	opts.OnWritten = nil
+	return src, dst, content, opts
+}
+
+func TestResumeCopyDirSrcChanged(t *testing.T) {
+	// The size of src is changed since the checkpoint.
+	src, dst, content, opts := stopDirCopy(t)
+	if err := os.WriteFile(filepath.Join(src, "a.bin"), append(content, 'x'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := cp.ResumeCopyDir(context.Background(), src, dst, opts)
+	checkResumeMismatch(t, err, filepath.Join(src, "a.bin"))
+
+	// The modification time of src is changed since the checkpoint.
+	src, dst, _, opts = stopDirCopy(t)
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(src, "a.bin"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	_, err = cp.ResumeCopyDir(context.Background(), src, dst, opts)
+	checkResumeMismatch(t, err, filepath.Join(src, "a.bin"))
+}
+
+func TestResumeCopyDir(t *testing.T) {
+	src, dst, content, opts := stopDirCopy(t)
+
+	ckpt, err := cp.LoadCheckpoint(opts.Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := cp.ResumeCopyDir(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatalf("ResumeCopyDir() error: %v", err)
+	}
+	if want := int64(len(content)) - ckpt.Offset; n != want {
+		t.Errorf("ResumeCopyDir() = %v, want %v", n, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "a.bin")); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("content of dst differs: %v", err)
+	}
+	if _, err = os.Stat(opts.Checkpoint); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(checkpoint) error = %v, want ErrNotExist", err)
+	}
+}
+
+// noSeekFS wraps the files opened in the file system to hide their Seek and ReadAt methods.
+type noSeekFS struct {
+	fs.FS
+}
+
+func (fsys noSeekFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+func TestResumeCopyFSFileNonSeeker(t *testing.T) {
+	content := []byte("hello, world!")
+	fsys := noSeekFS{fstest.MapFS{"src.txt": &fstest.MapFile{Data: content, Mode: 0644}}}
+
+	// The prefix copied previously is read and discarded.
+	for _, check := range []cp.ResumeCheck{cp.ResumeCheckNone, cp.ResumeCheckSize} {
+		_, dst := newResumeFiles(t, content, content[:5])
+
+		opts := &cp.Options{ResumeCheck: check, Buf: make([]byte, 2)}
+		n, err := cp.CopyFSFileWithOptions(context.Background(), fsys, "src.txt", dst, 5, opts)
+		if err != nil || n != int64(len(content))-5 {
+			t.Fatalf("%v: CopyFSFileWithOptions() = %v, %v, want %v, nil", check, n, err, len(content)-5)
+		}
+
+		if data, err := os.ReadFile(dst); err != nil || string(data) != string(content) {
+			t.Errorf("%v: dst = %q, %v, want %q", check, data, err, content)
+		}
+	}
+
+	// The prefix is hashed to compute the checksum of the whole file.
+	_, dst := newResumeFiles(t, content, content[:5])
+	n, sums, err := cp.CopyFSFileWithHashes(context.Background(), fsys, "src.txt", dst, 5, []hash.Hash{sha256.New()}, &cp.Options{Buf: make([]byte, 2)})
+	if err != nil || n != int64(len(content))-5 {
+		t.Fatalf("CopyFSFileWithHashes() = %v, %v, want %v, nil", n, err, len(content)-5)
+	}
+	checkSums(t, "CopyFSFileWithHashes()", sums, helloSHA256)
+
+	// src is shorter than the prefix.
+	_, dst = newResumeFiles(t, content, content)
+	if _, err = cp.CopyFSFileWithOptions(context.Background(), fsys, "src.txt", dst, int64(len(content))+1, nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("CopyFSFileWithOptions() error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,141 @@
+package cp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// source abstracts the file system that files are copied from.
+// It lets the copy functions share one implementation for the local file system and [fs.FS].
+type source interface {
+	// stat returns the file info of name. It follows symlinks.
+	stat(name string) (fs.FileInfo, error)
+	// lstat returns the file info of name. It does not follow symlinks if the source supports them.
+	lstat(name string) (fs.FileInfo, error)
+	// open opens name for reading.
+	open(name string) (fs.File, error)
+	// readDir reads the dir and returns the entries sorted by file name.
+	readDir(name string) ([]fs.DirEntry, error)
+	// readLink returns the target of the symlink.
+	readLink(name string) (string, error)
+	// join joins the dir and the file name.
+	join(dir, name string) string
+	// rel returns the path of target relative to base in slash-separated form.
+	rel(base, target string) (string, error)
+	// errNotRegular returns the error reported when src is not a regular file.
+	errNotRegular() error
+}
+
+// osSource is the source of the local file system.
+type osSource struct{}
+
+func (osSource) stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osSource) lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osSource) open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osSource) readDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osSource) readLink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (osSource) join(dir, name string) string {
+	return filepath.Join(dir, name)
+}
+
+func (osSource) rel(base, target string) (string, error) {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (osSource) errNotRegular() error {
+	return ErrNotRegularFile
+}
+
+// readLinkFS is the interface implemented by a file system that supports symlinks.
+// It has the same methods as fs.ReadLinkFS added in Go 1.25.
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// fsSource is the source of a [fs.FS].
+// It supports symlinks if the file system implements ReadLink and Lstat.
+type fsSource struct {
+	fsys fs.FS
+}
+
+func (s fsSource) stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+func (s fsSource) lstat(name string) (fs.FileInfo, error) {
+	if fsys, ok := s.fsys.(readLinkFS); ok {
+		return fsys.Lstat(name)
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+func (s fsSource) open(name string) (fs.File, error) {
+	return s.fsys.Open(name)
+}
+
+func (s fsSource) readDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s fsSource) readLink(name string) (string, error) {
+	if fsys, ok := s.fsys.(readLinkFS); ok {
+		return fsys.ReadLink(name)
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+}
+
+func (fsSource) join(dir, name string) string {
+	return path.Join(dir, name)
+}
+
+func (fsSource) rel(base, target string) (string, error) {
+	base, target = path.Clean(base), path.Clean(target)
+	if base == target {
+		return ".", nil
+	}
+	if base == "." {
+		return target, nil
+	}
+	if !strings.HasPrefix(target, base+"/") {
+		return "", &fs.PathError{Op: "rel", Path: target, Err: fs.ErrInvalid}
+	}
+	return strings.TrimPrefix(target, base+"/"), nil
+}
+
+func (fsSource) errNotRegular() error {
+	return ErrNotFSRegularFile
+}
+
+// dstPath returns the destination path of the source path p under the source root src.
+func dstPath(s source, src, dst, p string) (string, error) {
+	rel, err := s.rel(src, p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dst, filepath.FromSlash(rel)), nil
+}
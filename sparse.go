@@ -0,0 +1,128 @@
+package cp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/northbright/iocopy"
+)
+
+// sparseBlockSize is the size of blocks to detect zeros.
+const sparseBlockSize = 4096
+
+// sparseWriter writes to the file and seeks over zero blocks to make holes.
+// The file should be truncated to the final size after writing, or the trailing holes are lost.
+type sparseWriter struct {
+	f *os.File
+}
+
+// Write implements [io.Writer] interface.
+func (w *sparseWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		block := p[:min(len(p), sparseBlockSize)]
+
+		if isZeros(block) {
+			if _, err = w.f.Seek(int64(len(block)), io.SeekCurrent); err != nil {
+				return n, err
+			}
+		} else {
+			if _, err = w.f.Write(block); err != nil {
+				return n, err
+			}
+		}
+
+		n += len(block)
+		p = p[len(block):]
+	}
+	return n, nil
+}
+
+// isZeros reports whether all bytes of p are zeros.
+func isZeros(p []byte) bool {
+	for _, b := range p {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// copySparse copies src to dst from offset and makes holes in dst.
+// It skips the holes of src by SEEK_DATA and SEEK_HOLE if they're supported,
+// and falls back to detect zero blocks.
+// The holes are reported as written bytes, so the progress is against the logical size.
+// offset: offset of src and dst to resume the copy.
+// size: logical size of src.
+func copySparse(
+	ctx context.Context,
+	dst *os.File,
+	src io.Reader,
+	buf []byte,
+	offset int64,
+	size int64,
+	total int64,
+	prev int64,
+	fn iocopy.OnWrittenFunc) (n int64, err error) {
+	w := &sparseWriter{f: dst}
+
+	f, ok := src.(*os.File)
+	if !ok {
+		// Source of fs.FS, detect zero blocks only.
+		if n, err = iocopy.CopyBufferWithProgress(ctx, w, src, buf, total, prev, fn); err != nil {
+			return n, err
+		}
+		return n, dst.Truncate(offset + n)
+	}
+
+	for pos := offset; pos < size; {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+
+		start, end, err := nextDataRange(f, pos)
+		switch {
+		case err == io.EOF:
+			// The rest is a hole.
+			start, end = size, size
+		case errors.Is(err, errors.ErrUnsupported):
+			// Detect zero blocks for the rest.
+			if _, err = f.Seek(pos, io.SeekStart); err != nil {
+				return n, err
+			}
+
+			m, err := iocopy.CopyBufferWithProgress(ctx, w, f, buf, total, prev+n, fn)
+			n += m
+			if err != nil {
+				return n, err
+			}
+			return n, dst.Truncate(offset + n)
+		case err != nil:
+			return n, err
+		}
+
+		// Skip the hole.
+		if start > pos {
+			if _, err = dst.Seek(start-pos, io.SeekCurrent); err != nil {
+				return n, err
+			}
+			n += start - pos
+
+			reportProgress(fn, total, prev, n)
+		}
+
+		// Copy the data.
+		if end > start {
+			m, err := iocopy.CopyBufferWithProgress(ctx, w, io.LimitReader(f, end-start), buf, total, prev+n, fn)
+			n += m
+			if err != nil {
+				return n, err
+			}
+		}
+
+		pos = end
+	}
+
+	return n, dst.Truncate(offset + n)
+}
@@ -0,0 +1,38 @@
+package cp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+const (
+	// Whence values of lseek on Linux.
+	seekData = 3
+	seekHole = 4
+)
+
+// nextDataRange returns the next data range [start, end) of f from off and seeks f to start.
+// It returns io.EOF if there's no more data,
+// or errors.ErrUnsupported if SEEK_DATA is not supported by the file system.
+func nextDataRange(f *os.File, off int64) (start, end int64, err error) {
+	if start, err = f.Seek(off, seekData); err != nil {
+		switch {
+		case errors.Is(err, syscall.ENXIO):
+			return 0, 0, io.EOF
+		case errors.Is(err, syscall.EINVAL), errors.Is(err, syscall.EOPNOTSUPP):
+			return 0, 0, errors.ErrUnsupported
+		}
+		return 0, 0, err
+	}
+
+	if end, err = f.Seek(start, seekHole); err != nil {
+		return 0, 0, err
+	}
+
+	if _, err = f.Seek(start, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package cp
+
+import (
+	"errors"
+	"os"
+)
+
+// nextDataRange returns the next data range [start, end) of f from off and seeks f to start.
+// SEEK_DATA is not supported on this platform and it always returns errors.ErrUnsupported.
+func nextDataRange(f *os.File, off int64) (start, end int64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,123 @@
+//go:build unix
+
+package cp_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/northbright/cp"
+)
+
+const sparseTestSize = 1 << 20
+
+// newSparseFile creates a sparse file with data blocks at the start and in the middle, and a trailing hole.
+// It returns the path and the content of the file.
+func newSparseFile(t *testing.T) (string, []byte) {
+	t.Helper()
+
+	content := make([]byte, sparseTestSize)
+	copy(content, bytes.Repeat([]byte("a"), 4096))
+	copy(content[sparseTestSize/2:], bytes.Repeat([]byte("b"), 8192))
+
+	name := filepath.Join(t.TempDir(), "sparse")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err = f.Truncate(sparseTestSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt(content[:4096], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt(content[sparseTestSize/2:sparseTestSize/2+8192], sparseTestSize/2); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isSparse(t, name) {
+		t.Skip("the file system does not support sparse files")
+	}
+	return name, content
+}
+
+// isSparse reports whether the file has fewer allocated bytes than its size.
+func isSparse(t *testing.T, name string) bool {
+	t.Helper()
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Sys().(*syscall.Stat_t).Blocks*512 < fi.Size()
+}
+
+// checkSparseCopy checks the content, the holes and the final progress of the sparse copy.
+func checkSparseCopy(t *testing.T, dst string, content []byte, n, last int64) {
+	t.Helper()
+
+	if n != sparseTestSize || last != sparseTestSize {
+		t.Errorf("copied %v bytes, last progress %v, want %v", n, last, sparseTestSize)
+	}
+
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("content of dst differs from src")
+	}
+
+	if !isSparse(t, dst) {
+		t.Errorf("dst is not sparse")
+	}
+}
+
+func TestCopyFileSparse(t *testing.T) {
+	src, content := newSparseFile(t)
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	var last int64
+	opts := &cp.Options{
+		Sparse:   true,
+		FastPath: cp.FastPathNever,
+		OnWritten: func(total, prev, current int64, percent float32) {
+			last = prev + current
+		},
+	}
+
+	n, err := cp.CopyFileWithOptions(context.Background(), src, dst, 0, opts)
+	if err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	checkSparseCopy(t, dst, content, n, last)
+}
+
+func TestCopyFSFileSparse(t *testing.T) {
+	// Files of fstest.MapFS are not *os.File, so the zero blocks are detected while copying.
+	_, content := newSparseFile(t)
+	fsys := fstest.MapFS{"sparse": &fstest.MapFile{Data: content, Mode: 0644}}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	var last int64
+	opts := &cp.Options{
+		Sparse: true,
+		OnWritten: func(total, prev, current int64, percent float32) {
+			last = prev + current
+		},
+	}
+
+	n, err := cp.CopyFSFileWithOptions(context.Background(), fsys, "sparse", dst, 0, opts)
+	if err != nil {
+		t.Fatalf("CopyFSFileWithOptions() error: %v", err)
+	}
+	checkSparseCopy(t, dst, content, n, last)
+}
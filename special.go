@@ -0,0 +1,46 @@
+package cp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+var (
+	// ErrSpecialFile represents the error that src is a special file(named pipe, socket or device).
+	// It's wrapped in a [fs.PathError] which contains the path of the special file.
+	ErrSpecialFile = errors.New("special file")
+)
+
+// SpecialFilePolicy specifies how to handle special files(named pipes, sockets and devices) in dir copies.
+// Special files are never opened, so a named pipe can not block the copy.
+type SpecialFilePolicy int
+
+const (
+	// SpecialFileSkip skips special files.
+	SpecialFileSkip SpecialFilePolicy = iota
+	// SpecialFileRecreate recreates special files with mknod and mkfifo.
+	// It's only supported on Unix-like platforms and usually requires root privilege for devices.
+	SpecialFileRecreate
+	// SpecialFileError stops the copy with a [fs.PathError] wrapping ErrSpecialFile.
+	SpecialFileError
+)
+
+// isSpecial reports whether the file info is a special file.
+// Dirs, regular files and symlinks are not special files.
+func isSpecial(fi fs.FileInfo) bool {
+	return !fi.Mode().IsRegular() && !fi.IsDir() && !isSymlink(fi)
+}
+
+// specialFileError returns the error for the special file p.
+func specialFileError(p string) error {
+	return &fs.PathError{Op: "copy", Path: p, Err: ErrSpecialFile}
+}
+
+// removeIfNotDir removes the existing dst if it's not a dir.
+func removeIfNotDir(dst string) error {
+	if fi, err := os.Lstat(dst); err == nil && !fi.IsDir() {
+		return os.Remove(dst)
+	}
+	return nil
+}
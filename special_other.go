@@ -0,0 +1,14 @@
+//go:build !unix || aix || hurd
+
+package cp
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// createSpecial creates the special file dst.
+// Special files can not be created on this platform.
+func createSpecial(dst string, fi fs.FileInfo) error {
+	return &fs.PathError{Op: "mknod", Path: dst, Err: errors.ErrUnsupported}
+}
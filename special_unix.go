@@ -0,0 +1,46 @@
+//go:build unix && !aix && !hurd
+
+package cp
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// createSpecial creates the special file dst with the type, permission and device number of fi.
+func createSpecial(dst string, fi fs.FileInfo) error {
+	if err := removeIfNotDir(dst); err != nil {
+		return err
+	}
+
+	mode := uint32(fi.Mode().Perm())
+	dev := uint64(0)
+
+	switch t := fi.Mode().Type(); {
+	case t&fs.ModeNamedPipe != 0:
+		mode |= syscall.S_IFIFO
+	case t&fs.ModeSocket != 0:
+		mode |= syscall.S_IFSOCK
+	case t&fs.ModeDevice != 0:
+		// Device number is only available in the file info of the local file system.
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			return &fs.PathError{Op: "mknod", Path: dst, Err: errors.ErrUnsupported}
+		}
+
+		if t&fs.ModeCharDevice != 0 {
+			mode |= syscall.S_IFCHR
+		} else {
+			mode |= syscall.S_IFBLK
+		}
+		dev = uint64(st.Rdev)
+	default:
+		return &fs.PathError{Op: "mknod", Path: dst, Err: errors.ErrUnsupported}
+	}
+
+	if err := mknod(dst, mode, dev); err != nil {
+		return &fs.PathError{Op: "mknod", Path: dst, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+//go:build unix && !aix && !hurd
+
+package cp_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/northbright/cp"
+)
+
+// newFIFODir creates a dir which contains a regular file and a named pipe.
+func newFIFODir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(dir, "fifo"), 0640); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	return dir
+}
+
+func TestCopyDirSkipsFIFO(t *testing.T) {
+	src := newFIFODir(t)
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	// A named pipe without writers blocks the copy if it's opened.
+	done := make(chan error, 1)
+	go func() {
+		_, err := cp.CopyDir(context.Background(), src, dst, nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("CopyDir() error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("CopyDir() blocked on the named pipe")
+	}
+
+	if _, err := os.Lstat(filepath.Join(dst, "fifo")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Lstat(dst/fifo) error = %v, want ErrNotExist", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "a.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("dst/a.txt = %q, %v, want %q", data, err, "hello")
+	}
+}
+
+func TestDirInfoExcludesFIFO(t *testing.T) {
+	src := newFIFODir(t)
+
+	di, err := cp.DirInfo(src, nil)
+	if err != nil {
+		t.Fatalf("DirInfo() error: %v", err)
+	}
+	if di.FileCount != 1 || di.TotalSize != 5 || di.SpecialFileCount != 0 {
+		t.Errorf("DirInfo() = FileCount %v, TotalSize %v, SpecialFileCount %v, want 1, 5, 0",
+			di.FileCount, di.TotalSize, di.SpecialFileCount)
+	}
+
+	di, err = cp.DirInfoWithOptions(src, &cp.Options{SpecialFiles: cp.SpecialFileRecreate})
+	if err != nil {
+		t.Fatalf("DirInfoWithOptions() error: %v", err)
+	}
+	if di.FileCount != 1 || di.TotalSize != 5 || di.SpecialFileCount != 1 {
+		t.Errorf("DirInfoWithOptions() = FileCount %v, TotalSize %v, SpecialFileCount %v, want 1, 5, 1",
+			di.FileCount, di.TotalSize, di.SpecialFileCount)
+	}
+}
+
+func TestCopyDirSpecialFileError(t *testing.T) {
+	src := newFIFODir(t)
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	_, err := cp.CopyDirWithOptions(context.Background(), src, dst, &cp.Options{SpecialFiles: cp.SpecialFileError})
+
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("CopyDirWithOptions() error = %v, want *fs.PathError", err)
+	}
+	if !errors.Is(err, cp.ErrSpecialFile) {
+		t.Errorf("CopyDirWithOptions() error = %v, want ErrSpecialFile", err)
+	}
+	if want := filepath.Join(src, "fifo"); pathErr.Path != want {
+		t.Errorf("PathError.Path = %v, want %v", pathErr.Path, want)
+	}
+}
+
+func TestCopyDirRecreatesFIFO(t *testing.T) {
+	src := newFIFODir(t)
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, &cp.Options{SpecialFiles: cp.SpecialFileRecreate}); err != nil {
+		t.Fatalf("CopyDirWithOptions() error: %v", err)
+	}
+
+	fi, err := os.Lstat(filepath.Join(dst, "fifo"))
+	if err != nil {
+		t.Fatalf("Lstat(dst/fifo) error: %v", err)
+	}
+	if fi.Mode().Type() != fs.ModeNamedPipe {
+		t.Errorf("dst/fifo type = %v, want named pipe", fi.Mode().Type())
+	}
+	if fi.Mode().Perm() != 0640&^umask() {
+		t.Errorf("dst/fifo perm = %v, want %v", fi.Mode().Perm(), fs.FileMode(0640&^umask()))
+	}
+}
+
+func TestCopyDirReportsSkippedEntries(t *testing.T) {
+	src := newFIFODir(t)
+	if err := os.Symlink("a.txt", filepath.Join(src, "l.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{0, 4} {
+		dst := filepath.Join(t.TempDir(), "dst")
+
+		// The callback is never called concurrently.
+		outcomes := map[string]cp.Outcome{}
+		opts := &cp.Options{
+			Symlinks: cp.SymlinkSkip,
+			Workers:  workers,
+			AfterFile: func(r *cp.FileResult) {
+				outcomes[filepath.Base(r.Src)] = r.Outcome
+			},
+		}
+
+		if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts); err != nil {
+			t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+		}
+
+		// The symlink and the named pipe skipped by the policies are reported.
+		for name, want := range map[string]cp.Outcome{"a.txt": cp.OutcomeCreated, "fifo": cp.OutcomeSkipped, "l.txt": cp.OutcomeSkipped} {
+			if got, ok := outcomes[name]; !ok || got != want {
+				t.Errorf("workers %v: outcome of %v = %v, %v, want %v", workers, name, got, ok, want)
+			}
+		}
+	}
+}
+
+// umask returns the file mode creation mask of the process.
+func umask() fs.FileMode {
+	m := syscall.Umask(0)
+	syscall.Umask(m)
+	return fs.FileMode(m)
+}
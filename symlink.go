@@ -0,0 +1,77 @@
+package cp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrSymlinkLoop represents the error that following symlinks results in a loop.
+	ErrSymlinkLoop = errors.New("symlink loop")
+)
+
+// SymlinkPolicy specifies how to handle symlinks in the source.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow copies the targets of symlinks.
+	// Symlinks to dirs are walked with loop detection.
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkPreserve recreates symlinks as symlinks in the destination.
+	SymlinkPreserve
+	// SymlinkSkip skips symlinks in dir copies.
+	// File copies reject symlinks with ErrNotRegularFile or ErrNotFSRegularFile.
+	SymlinkSkip
+)
+
+// maxFollowedLinks is the max number of followed symlinks to dirs in one path.
+// It stops the walk when loops can not be detected by comparing file infos.
+const maxFollowedLinks = 40
+
+// symlinkTarget returns the target of the symlink p to create in the destination.
+// If rewrite is true and the target is an absolute path inside src,
+// it returns the corresponding path inside dst.
+// Rewriting is only available for the local file system.
+func symlinkTarget(s source, src, dst, p string, rewrite bool) (string, error) {
+	target, err := s.readLink(p)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := s.(osSource); !ok || !rewrite || !filepath.IsAbs(target) {
+		return target, nil
+	}
+
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(absSrc, target)
+	if err != nil || !filepath.IsLocal(rel) {
+		// The target is outside src.
+		return target, nil
+	}
+
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(absDst, rel), nil
+}
+
+// createSymlink creates dst as a symlink to target.
+// An existing non-dir dst is replaced.
+func createSymlink(target, dst string) error {
+	if err := removeIfNotDir(dst); err != nil {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+// isSymlink reports whether the file info is a symlink.
+func isSymlink(fi fs.FileInfo) bool {
+	return fi.Mode()&fs.ModeSymlink != 0
+}
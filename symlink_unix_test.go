@@ -0,0 +1,209 @@
+//go:build unix
+
+package cp_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/northbright/cp"
+)
+
+func TestCopyFSFileFollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "l.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "out.txt")
+	n, err := cp.CopyFSFile(context.Background(), os.DirFS(dir), "l.txt", dst)
+	if err != nil {
+		t.Fatalf("CopyFSFile() error: %v", err)
+	}
+	if n != 5 {
+		t.Errorf("CopyFSFile() = %v bytes, want 5", n)
+	}
+
+	data, err := os.ReadFile(dst)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("dst = %q, %v, want %q", data, err, "hello")
+	}
+}
+
+func TestCopyFileRejectsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "l.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := cp.CopyFile(context.Background(), filepath.Join(dir, "l.txt"), filepath.Join(dir, "out.txt"))
+	if !errors.Is(err, cp.ErrNotRegularFile) {
+		t.Errorf("CopyFile() error = %v, want ErrNotRegularFile", err)
+	}
+}
+
+// newSymlinkDir creates a dir which contains a file, a dir and symlinks to them with relative and absolute targets.
+// It returns the dir and the absolute target outside the dir.
+func newSymlinkDir(t *testing.T) (string, string) {
+	t.Helper()
+
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"a.txt": "hello", "sub/b.txt": "world!"})
+
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	if err := os.WriteFile(outside, []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	links := map[string]string{
+		"rel.txt":     "a.txt",
+		"abs.txt":     filepath.Join(src, "a.txt"),
+		"outside.txt": outside,
+		"dir":         "sub",
+		"sub/up.txt":  "../a.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(src, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src, outside
+}
+
+func TestCopyDirSymlinkPreserve(t *testing.T) {
+	src, outside := newSymlinkDir(t)
+
+	di, err := cp.DirInfoWithOptions(src, &cp.Options{Symlinks: cp.SymlinkPreserve})
+	if err != nil {
+		t.Fatalf("DirInfoWithOptions() error: %v", err)
+	}
+	if di.FileCount != 2 || di.SymlinkCount != 5 || di.TotalSize != 11 {
+		t.Errorf("DirInfoWithOptions() = FileCount %v, SymlinkCount %v, TotalSize %v, want 2, 5, 11", di.FileCount, di.SymlinkCount, di.TotalSize)
+	}
+
+	for _, rewrite := range []bool{false, true} {
+		dst := filepath.Join(t.TempDir(), "dst")
+
+		opts := &cp.Options{Symlinks: cp.SymlinkPreserve, RewriteSymlinks: rewrite}
+		n, err := cp.CopyDirWithOptions(context.Background(), src, dst, opts)
+		if err != nil {
+			t.Fatalf("rewrite %v: CopyDirWithOptions() error: %v", rewrite, err)
+		}
+		if n != 11 {
+			t.Errorf("rewrite %v: CopyDirWithOptions() = %v, want 11", rewrite, n)
+		}
+
+		// Only the absolute target inside src is rewritten.
+		abs := filepath.Join(src, "a.txt")
+		if rewrite {
+			abs = filepath.Join(dst, "a.txt")
+		}
+
+		for name, want := range map[string]string{
+			"rel.txt":     "a.txt",
+			"abs.txt":     abs,
+			"outside.txt": outside,
+			"dir":         "sub",
+			"sub/up.txt":  "../a.txt",
+		} {
+			if target, err := os.Readlink(filepath.Join(dst, filepath.FromSlash(name))); err != nil || target != want {
+				t.Errorf("rewrite %v: Readlink(dst/%v) = %v, %v, want %v", rewrite, name, target, err, want)
+			}
+		}
+	}
+}
+
+func TestCopyDirSymlinkFollow(t *testing.T) {
+	src, _ := newSymlinkDir(t)
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	if _, err := cp.CopyDirWithOptions(context.Background(), src, dst, nil); err != nil {
+		t.Fatalf("CopyDirWithOptions() error: %v", err)
+	}
+
+	// The targets are copied as regular files and dirs.
+	checkFiles(t, dst, map[string]string{
+		"rel.txt":     "hello",
+		"abs.txt":     "hello",
+		"outside.txt": "outside",
+		"dir/b.txt":   "world!",
+		"dir/up.txt":  "hello",
+	}, nil)
+	if fi, err := os.Lstat(filepath.Join(dst, "dir")); err != nil || !fi.IsDir() {
+		t.Errorf("dst/dir is not a dir: %v", err)
+	}
+}
+
+func TestCopyDirSymlinkLoop(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string]string{"sub/a.txt": "a"})
+	if err := os.Symlink("..", filepath.Join(src, "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := cp.CopyDirWithOptions(context.Background(), src, filepath.Join(t.TempDir(), "dst"), nil)
+	if !errors.Is(err, cp.ErrSymlinkLoop) {
+		t.Errorf("CopyDirWithOptions() error = %v, want ErrSymlinkLoop", err)
+	}
+	if _, err = cp.DirInfo(src, nil); !errors.Is(err, cp.ErrSymlinkLoop) {
+		t.Errorf("DirInfo() error = %v, want ErrSymlinkLoop", err)
+	}
+
+	// The loop is kept as a symlink.
+	dst := filepath.Join(t.TempDir(), "dst")
+	if _, err = cp.CopyDirWithOptions(context.Background(), src, dst, &cp.Options{Symlinks: cp.SymlinkPreserve}); err != nil {
+		t.Fatalf("CopyDirWithOptions() error: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "sub", "loop")); err != nil || target != ".." {
+		t.Errorf("Readlink(dst/sub/loop) = %v, %v, want ..", target, err)
+	}
+}
+
+func TestCopyFileSymlinkPreserve(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Symlink("missing.txt", filepath.Join(dir, "l.txt")); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "out.txt")
+
+	var res *cp.FileResult
+	opts := &cp.Options{
+		Symlinks:  cp.SymlinkPreserve,
+		AfterFile: func(r *cp.FileResult) { res = r },
+	}
+
+	// The dangling symlink is recreated without reading the target.
+	n, err := cp.CopyFileWithOptions(context.Background(), filepath.Join(dir, "l.txt"), dst, 0, opts)
+	if err != nil || n != 0 {
+		t.Fatalf("CopyFileWithOptions() = %v, %v, want 0, nil", n, err)
+	}
+	if target, err := os.Readlink(dst); err != nil || target != "missing.txt" {
+		t.Errorf("Readlink(dst) = %v, %v, want missing.txt", target, err)
+	}
+	if res == nil || res.Outcome != cp.OutcomeCreated {
+		t.Errorf("FileResult = %+v, want OutcomeCreated", res)
+	}
+
+	// The existing symlink is replaced.
+	if err = os.Remove(filepath.Join(dir, "l.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink("other.txt", filepath.Join(dir, "l.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cp.CopyFileWithOptions(context.Background(), filepath.Join(dir, "l.txt"), dst, 0, opts); err != nil {
+		t.Fatalf("CopyFileWithOptions() error: %v", err)
+	}
+	if target, err := os.Readlink(dst); err != nil || target != "other.txt" || res.Outcome != cp.OutcomeOverwritten {
+		t.Errorf("Readlink(dst) = %v, %v, outcome %v, want other.txt, overwritten", target, err, res.Outcome)
+	}
+}
@@ -0,0 +1,81 @@
+package cp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"github.com/northbright/iocopy"
+)
+
+var (
+	// ErrVerifyMismatch represents the error that the checksum of the destination file does not match the source.
+	// It's wrapped in a [fs.PathError] which contains the path of the destination file.
+	ErrVerifyMismatch = errors.New("checksum mismatch")
+)
+
+// HashAlgorithm is the hash algorithm to verify the copied files.
+type HashAlgorithm int
+
+const (
+	// HashNone disables the verification.
+	HashNone HashAlgorithm = iota
+	// HashSHA256 uses SHA-256.
+	HashSHA256
+	// HashCRC32C uses CRC-32 with Castagnoli polynomial.
+	// It's a fast non-cryptographic checksum accelerated by the hardware on most platforms.
+	HashCRC32C
+)
+
+// String implements [fmt.Stringer] interface.
+func (a HashAlgorithm) String() string {
+	switch a {
+	case HashNone:
+		return "none"
+	case HashSHA256:
+		return "sha256"
+	case HashCRC32C:
+		return "crc32c"
+	default:
+		return "HashAlgorithm(" + strconv.Itoa(int(a)) + ")"
+	}
+}
+
+// New returns a new hash.Hash of the algorithm.
+// It returns nil for HashNone.
+func (a HashAlgorithm) New() hash.Hash {
+	switch a {
+	case HashSHA256:
+		return sha256.New()
+	case HashCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	default:
+		return nil
+	}
+}
+
+// verifyFile re-reads the file and compares its checksum with sum.
+// dst: destination file to report the error. It may differ from name while writing atomically.
+func verifyFile(ctx context.Context, name, dst string, a HashAlgorithm, sum []byte, buf []byte) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := a.New()
+	if _, err = iocopy.CopyBuffer(ctx, h, f, buf); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h.Sum(nil), sum) {
+		return &fs.PathError{Op: "verify", Path: dst, Err: ErrVerifyMismatch}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package cp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	content := []byte("hello, world!")
+	dir := t.TempDir()
+
+	// name is the temporary file written atomically and dst is the final name.
+	name, dst := filepath.Join(dir, ".dst.tmp"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(name, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(content)
+	if err := verifyFile(context.Background(), name, dst, HashSHA256, sum[:], nil); err != nil {
+		t.Errorf("verifyFile() error: %v", err)
+	}
+
+	// dst is corrupted after it's written.
+	if err := os.WriteFile(name, []byte("hello, World!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := verifyFile(context.Background(), name, dst, HashSHA256, sum[:], nil)
+
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || !errors.Is(err, ErrVerifyMismatch) {
+		t.Fatalf("verifyFile() error = %v, want *fs.PathError wrapping ErrVerifyMismatch", err)
+	}
+	if pathErr.Path != dst {
+		t.Errorf("PathError.Path = %v, want %v", pathErr.Path, dst)
+	}
+}
+
+func TestCopyFileVerifyDigest(t *testing.T) {
+	content := []byte("hello, world!")
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sha := sha256.Sum256(content)
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	crc.Write(content)
+
+	for _, tc := range []struct {
+		a    HashAlgorithm
+		want []byte
+	}{
+		{HashSHA256, sha[:]},
+		{HashCRC32C, crc.Sum(nil)},
+	} {
+		for _, atomic := range []bool{false, true} {
+			var digest []byte
+			opts := &Options{
+				Verify: tc.a,
+				Atomic: atomic,
+				AfterFile: func(r *FileResult) {
+					digest = r.Digest
+				},
+			}
+
+			dst := filepath.Join(dir, "dst")
+			if _, err := CopyFileWithOptions(context.Background(), src, dst, 0, opts); err != nil {
+				t.Fatalf("%v, atomic %v: CopyFileWithOptions() error: %v", tc.a, atomic, err)
+			}
+			if !bytes.Equal(digest, tc.want) {
+				t.Errorf("%v, atomic %v: FileResult.Digest = %x, want %x", tc.a, atomic, digest, tc.want)
+			}
+		}
+	}
+
+	// No digest without Options.Verify.
+	digest := []byte{}
+	opts := &Options{AfterFile: func(r *FileResult) { digest = r.Digest }}
+	if _, err := CopyFileWithOptions(context.Background(), src, filepath.Join(dir, "dst"), 0, opts); err != nil {
+		t.Fatal(err)
+	}
+	if digest != nil {
+		t.Errorf("FileResult.Digest = %x, want nil", digest)
+	}
+}
+
+func TestCopyDirVerifyDigest(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	files := map[string][]byte{
+		"a.txt":       []byte("a"),
+		"b.txt":       bytes.Repeat([]byte("b"), 100000),
+		"sub/c.txt":   []byte("c"),
+		"sub/d/e.txt": []byte(""),
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, workers := range []int{0, 4} {
+		var mu sync.Mutex
+		digests := map[string][]byte{}
+
+		opts := &Options{
+			Verify:  HashSHA256,
+			Workers: workers,
+			AfterFile: func(r *FileResult) {
+				rel, err := filepath.Rel(src, r.Src)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				mu.Lock()
+				digests[filepath.ToSlash(rel)] = r.Digest
+				mu.Unlock()
+			},
+		}
+
+		dst := filepath.Join(t.TempDir(), "dst")
+		if _, err := CopyDirWithOptions(context.Background(), src, dst, opts); err != nil {
+			t.Fatalf("workers %v: CopyDirWithOptions() error: %v", workers, err)
+		}
+
+		if len(digests) != len(files) {
+			t.Errorf("workers %v: %v digests reported, want %v", workers, len(digests), len(files))
+		}
+		for name, content := range files {
+			if want := sha256.Sum256(content); !bytes.Equal(digests[name], want[:]) {
+				t.Errorf("workers %v: digest of %v = %x, want %x", workers, name, digests[name], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package cp
+
+import (
+	"io/fs"
+	"os"
+)
+
+// walkFunc is the type of the function called by walk for each file or dir.
+// fi is the info of the symlink's target if the symlink is followed.
+// Returning fs.SkipDir skips the dir, or the remaining files in the parent dir if p is a file.
+type walkFunc func(p string, fi fs.FileInfo) error
+
+// walker walks the file tree of a source.
+// Unlike [fs.WalkDir], it's able to follow symlinks to dirs.
+type walker struct {
+	s      source
+	follow bool
+	fn     walkFunc
+	// post is called for each dir after its entries are walked. It's optional.
+	post walkFunc
+}
+
+// walk walks the file tree rooted at root and calls fn for each file or dir, including root.
+// root is always followed if it's a symlink.
+// follow: whether to follow symlinks in the tree.
+func walk(s source, root string, follow bool, fn walkFunc) error {
+	return walkPost(s, root, follow, fn, nil)
+}
+
+// walkPost is like walk, and it also calls post for each dir after its entries are walked.
+// post is not called for the dirs skipped by fn.
+func walkPost(s source, root string, follow bool, fn, post walkFunc) error {
+	fi, err := s.stat(root)
+	if err != nil {
+		return err
+	}
+
+	w := &walker{s: s, follow: follow, fn: fn, post: post}
+	err = w.walk(root, fi, nil, 0)
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walk walks p recursively.
+// ancestors: file infos of the ancestor dirs to detect symlink loops.
+// links: number of followed symlinks to dirs in the path.
+func (w *walker) walk(p string, fi fs.FileInfo, ancestors []fs.FileInfo, links int) error {
+	if err := w.fn(p, fi); err != nil || !fi.IsDir() {
+		if err == fs.SkipDir && fi.IsDir() {
+			// Skip the dir.
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := w.s.readDir(p)
+	if err != nil {
+		return err
+	}
+
+	ancestors = append(ancestors, fi)
+
+	for _, e := range entries {
+		name := w.s.join(p, e.Name())
+		n := links
+
+		var efi fs.FileInfo
+		if e.Type()&fs.ModeSymlink != 0 && w.follow {
+			if efi, err = w.s.stat(name); err != nil {
+				return err
+			}
+
+			if efi.IsDir() {
+				n++
+				if n > maxFollowedLinks || isAncestor(efi, ancestors) {
+					return &fs.PathError{Op: "walk", Path: name, Err: ErrSymlinkLoop}
+				}
+			}
+		} else {
+			if efi, err = e.Info(); err != nil {
+				return err
+			}
+		}
+
+		if err := w.walk(name, efi, ancestors, n); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+
+	if w.post != nil {
+		return w.post(p, fi)
+	}
+	return nil
+}
+
+// isAncestor reports whether the dir is one of the ancestors.
+func isAncestor(dir fs.FileInfo, ancestors []fs.FileInfo) bool {
+	for _, a := range ancestors {
+		if os.SameFile(dir, a) {
+			return true
+		}
+	}
+	return false
+}